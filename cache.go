@@ -0,0 +1,111 @@
+package main
+
+import (
+	"assetgoblin/image"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// purgeCache removes the cached derivatives selected by filter and prints what was removed.
+func purgeCache(filter image.PurgeFilter) {
+	if err := conf.Load(); err != nil {
+		slog.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	imageService := image.Service{Config: &conf.Image}
+	result, err := imageService.Purge(filter)
+	if err != nil {
+		slog.Error("Failed to purge cache", "error", err)
+		os.Exit(1)
+	}
+
+	for _, path := range result.Removed {
+		fmt.Println(path)
+	}
+	fmt.Printf("Removed %d derivatives (%d bytes) from %s\n", result.Count, result.Bytes, conf.Image.CacheDir)
+}
+
+// warmCache pre-generates the derivatives selected by opts, showing a progress bar
+// and printing a summary of failures. In dry-run mode, the derivatives are only listed.
+func warmCache(opts image.WarmOptions) {
+	if err := conf.Load(); err != nil {
+		slog.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	if !opts.DryRun {
+		opts.Progress = printProgress
+	}
+
+	imageService := image.Service{Config: &conf.Image}
+	result, err := imageService.Warm(opts)
+	if err != nil {
+		slog.Error("Failed to warm cache", "error", err)
+		os.Exit(1)
+	}
+
+	if opts.DryRun {
+		for _, job := range result.Jobs {
+			fmt.Printf("%s\t%s\t%s\n", job.Source, job.Preset, job.Format)
+		}
+		fmt.Printf("%d derivatives would be warmed\n", len(result.Jobs))
+		return
+	}
+
+	if len(result.Jobs) > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	for _, failure := range result.Failures {
+		fmt.Printf("FAILED %s\t%s\t%s: %v\n", failure.Job.Source, failure.Job.Preset, failure.Job.Format, failure.Err)
+	}
+	fmt.Printf("Generated %d, already cached %d, skipped %d, failed %d\n", result.Generated, result.Cached, result.Skipped, len(result.Failures))
+	if len(result.Failures) > 0 {
+		os.Exit(1)
+	}
+}
+
+// gcCache removes cached derivatives that can no longer be served and prints what was removed.
+// In dry-run mode, the files are only listed.
+func gcCache(dryRun bool) {
+	if err := conf.Load(); err != nil {
+		slog.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	imageService := image.Service{Config: &conf.Image, PublicDir: conf.PublicDir}
+	result, err := imageService.CollectGarbage(dryRun)
+	if err != nil {
+		slog.Error("Failed to collect garbage", "error", err)
+		os.Exit(1)
+	}
+
+	for _, entry := range result.Removed {
+		fmt.Printf("%s\t%s\n", entry.Path, entry.Reason)
+	}
+	if dryRun {
+		fmt.Printf("%d files (%d bytes) would be removed from %s\n", result.Count, result.Bytes, conf.Image.CacheDir)
+		return
+	}
+	fmt.Printf("Removed %d files (%d bytes) from %s\n", result.Count, result.Bytes, conf.Image.CacheDir)
+}
+
+// printProgress redraws a progress bar on standard error.
+func printProgress(done, total int) {
+	const width = 40
+	filled := width * done / total
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %d/%d", strings.Repeat("#", filled), strings.Repeat("-", width-filled), done, total)
+}
+
+// splitList splits a comma-separated flag value, ignoring empty items.
+func splitList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestSplitList verifies comma-separated flag values are split and trimmed.
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: "", want: nil},
+		{value: "webp", want: []string{"webp"}},
+		{value: " webp, avif ,,jpg", want: []string{"webp", "avif", "jpg"}},
+	}
+
+	for _, tt := range tests {
+		if got := splitList(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("splitList(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
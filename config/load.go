@@ -7,7 +7,9 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/spf13/viper"
@@ -16,23 +18,248 @@ import (
 // Config represents the main application configuration.
 // It contains settings for the server, image processing, rate limiting, and security.
 type Config struct {
-	Image          Image     `mapstructure:"image"`
-	Port           string    `mapstructure:"port"`
-	PublicDir      string    `mapstructure:"public_dir"`
-	RateLimit      RateLimit `mapstructure:"rate_limit"`
-	Secret         string    `mapstructure:"secret"`
-	UsedConfigFile string    `mapstructure:"-" json:"used_config_file"`
-	LoadedFromGob  bool      `mapstructure:"-" json:"loaded_from_gob"`
+	AccessLog       AccessLog     `mapstructure:"access_log"`
+	Admin           Admin         `mapstructure:"admin"`
+	Assets          Assets        `mapstructure:"assets"`
+	Compression     Compression   `mapstructure:"compression"`
+	CORS            CORS          `mapstructure:"cors"`
+	HTTPCache       HTTPCache     `mapstructure:"http_cache"`
+	Image           Image         `mapstructure:"image"`
+	Listen          Listen        `mapstructure:"listen"`
+	Metrics         Metrics       `mapstructure:"metrics"`
+	Port            string        `mapstructure:"port"`
+	PublicDir       string        `mapstructure:"public_dir"`
+	RateLimit       RateLimit     `mapstructure:"rate_limit"`
+	Secret          string        `mapstructure:"secret"`
+	Security        Security      `mapstructure:"security"`
+	Signing         Signing       `mapstructure:"signing"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	TLS             TLS           `mapstructure:"tls"`
+	Tracing         Tracing       `mapstructure:"tracing"`
+	UsedConfigFile  string        `mapstructure:"-" json:"used_config_file"`
+	LoadedFromGob   bool          `mapstructure:"-" json:"loaded_from_gob"`
+}
+
+// AccessLog contains configuration for the access log of all requests.
+// Format is "off", "common", "combined", "json" or "logfmt". Output is "stdout", "stderr" or a file path;
+// files are reopened on SIGHUP, so they can be rotated. Sampling rules are matched in order and the first
+// match decides which fraction of the requests is logged; requests matching no rule are always logged.
+type AccessLog struct {
+	Format   string          `mapstructure:"format"`
+	Output   string          `mapstructure:"output"`
+	Sampling []AccessLogRule `mapstructure:"sampling"`
+}
+
+// AccessLogRule samples the requests whose path starts with Prefix and whose status matches Status.
+// Status is a code like "404", a class like "2xx", or empty for any status. A rate of 0 drops the requests.
+type AccessLogRule struct {
+	Prefix string  `mapstructure:"prefix"`
+	Rate   float64 `mapstructure:"rate"`
+	Status string  `mapstructure:"status"`
+}
+
+// Admin contains configuration for the administrative API.
+// The API is disabled unless a token is set; requests must send it as a bearer token.
+type Admin struct {
+	Path  string `mapstructure:"path"`
+	Token string `mapstructure:"token"`
+}
+
+// Assets contains configuration for content-hashed URLs of files in the public directory.
+// A hashed URL inserts the first HashLength characters of the content hash before the extension,
+// e.g. "app.3f9a1c2b.css" for "app.css". Include and Exclude are glob patterns selecting the files.
+// Stale is "redirect" (redirect to the current hashed URL) or "not_found".
+// Manifest is the path of the manifest relative to the public directory.
+type Assets struct {
+	CacheControl string   `mapstructure:"cache_control"`
+	Exclude      []string `mapstructure:"exclude"`
+	HashLength   int      `mapstructure:"hash_length"`
+	Include      []string `mapstructure:"include"`
+	Manifest     string   `mapstructure:"manifest"`
+	Stale        string   `mapstructure:"stale"`
+}
+
+// Compression contains configuration for compressed responses of files in the public directory.
+// Precompressed .br, .zst and .gz siblings are served if they are not older than the file.
+// With Dynamic set, files of the listed MIME types of at least MinSize bytes are gzip-compressed
+// on the fly and the compressed copy is kept in CacheDir. Types ending with a slash match all subtypes.
+type Compression struct {
+	CacheDir      string   `mapstructure:"cache_dir"`
+	Dynamic       bool     `mapstructure:"dynamic"`
+	MinSize       int64    `mapstructure:"min_size"`
+	Precompressed bool     `mapstructure:"precompressed"`
+	Types         []string `mapstructure:"types"`
+}
+
+// CORS contains the cross-origin resource sharing policies of the image path and the public directory.
+type CORS struct {
+	Images CORSPolicy `mapstructure:"images"`
+	Public CORSPolicy `mapstructure:"public"`
+}
+
+// CORSPolicy is a cross-origin resource sharing policy. An empty list of origins disables it.
+// Origins are matched as glob patterns, e.g. "https://*.example.com", and "*" allows any origin.
+// AllowedHeaders lists the request headers allowed in preflight requests, "*" allows any header.
+// MaxAge is how long browsers may cache preflight responses; 0 sends no Access-Control-Max-Age header.
+type CORSPolicy struct {
+	AllowCredentials bool          `mapstructure:"allow_credentials"`
+	AllowedHeaders   []string      `mapstructure:"allowed_headers"`
+	AllowedMethods   []string      `mapstructure:"allowed_methods"`
+	AllowedOrigins   []string      `mapstructure:"allowed_origins"`
+	ExposedHeaders   []string      `mapstructure:"exposed_headers"`
+	MaxAge           time.Duration `mapstructure:"max_age"`
+}
+
+// HTTPCache contains the caching headers sent with responses.
+// Cache-Control values are sent as is and an empty value sends no header.
+// Images is used for image derivatives unless the preset sets its own value, and Errors for error responses.
+// Public rules are matched in order against paths relative to the public directory; the first match wins.
+type HTTPCache struct {
+	ETag         bool               `mapstructure:"etag"`
+	Errors       string             `mapstructure:"errors"`
+	Images       string             `mapstructure:"images"`
+	LastModified bool               `mapstructure:"last_modified"`
+	Public       []CacheControlRule `mapstructure:"public"`
+}
+
+// CacheControlRule sets the Cache-Control header of public files matching a glob pattern.
+// Patterns without a slash are matched against the file name only.
+type CacheControlRule struct {
+	CacheControl string `mapstructure:"cache_control"`
+	Pattern      string `mapstructure:"pattern"`
+}
+
+// Security contains the security headers sent with every response and the hardening of the public directory.
+// Header values are sent as is and an empty value sends no header. Dotfiles, except in .well-known, and files
+// matching a Hidden glob pattern are answered with 404, as are directories without index.html unless
+// DirectoryListing is set. Patterns without a slash are matched against each path segment.
+type Security struct {
+	ContentSecurityPolicy     string   `mapstructure:"content_security_policy"`
+	ContentTypeOptions        string   `mapstructure:"content_type_options"`
+	CrossOriginResourcePolicy string   `mapstructure:"cross_origin_resource_policy"`
+	DirectoryListing          bool     `mapstructure:"directory_listing"`
+	Hidden                    []string `mapstructure:"hidden"`
+	HideDotfiles              bool     `mapstructure:"hide_dotfiles"`
+	ReferrerPolicy            string   `mapstructure:"referrer_policy"`
+}
+
+// Signing contains configuration for the verification of signed URLs, enabled by setting the secret.
+// Tokens cover the path and the expiry time in the expires query parameter; they are accepted until
+// ClockSkew after the expiry time. With LegacyTokens, tokens of the path only remain valid forever.
+type Signing struct {
+	ClockSkew    time.Duration `mapstructure:"clock_skew"`
+	LegacyTokens bool          `mapstructure:"legacy_tokens"`
+}
+
+// TLS contains configuration for serving HTTPS. TLS is enabled when CertFile and KeyFile are set;
+// the files are reloaded when they change, so renewed certificates are picked up without a restart.
+// MinVersion is "1.2" or "1.3". If RedirectPort is set, plain HTTP requests on that port are
+// redirected to HTTPS.
+type TLS struct {
+	CertFile     string `mapstructure:"cert_file"`
+	KeyFile      string `mapstructure:"key_file"`
+	MinVersion   string `mapstructure:"min_version"`
+	RedirectPort string `mapstructure:"redirect_port"`
+}
+
+// Enabled reports whether HTTPS is configured.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// Listen contains configuration for the listener of the server.
+// If Socket is set, the server listens on that Unix domain socket instead of the TCP port;
+// SocketMode is the octal permission of the socket file, e.g. "0660".
+// Sockets passed by systemd socket activation take precedence over both.
+type Listen struct {
+	Socket     string `mapstructure:"socket"`
+	SocketMode string `mapstructure:"socket_mode"`
+}
+
+// Mode returns the permission of the socket file.
+func (l Listen) Mode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(l.SocketMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket mode %q", l.SocketMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// Metrics contains configuration for the Prometheus metrics endpoint. An empty path disables it.
+type Metrics struct {
+	Path string `mapstructure:"path"`
+}
+
+// Tracing contains configuration for exporting traces to an OpenTelemetry collector.
+// Endpoint is the OTLP/HTTP traces URL, e.g. "http://localhost:4318/v1/traces"; an empty endpoint disables tracing.
+// Requests without a sampled parent trace are sampled at SampleRate, between 0 and 1.
+type Tracing struct {
+	Endpoint    string  `mapstructure:"endpoint"`
+	SampleRate  float64 `mapstructure:"sample_rate"`
+	ServiceName string  `mapstructure:"service_name"`
 }
 
 // Image contains configuration for image processing and serving.
 type Image struct {
-	AvifThroughVips bool                         `mapstructure:"avif_through_vips"`
-	CacheDir        string                       `mapstructure:"cache_dir"`
-	Directory       string                       `mapstructure:"directory"`
-	Formats         []string                     `mapstructure:"formats"`
-	Path            string                       `mapstructure:"path"`
-	Presets         map[string]utils.ImagePreset `mapstructure:"presets"`
+	AllowedSizes        AllowedSizes                 `mapstructure:"allowed_sizes"`
+	AvifThroughVips     bool                         `mapstructure:"avif_through_vips"`
+	CacheDir            string                       `mapstructure:"cache_dir"`
+	CacheVersion        string                       `mapstructure:"cache_version"`
+	Directory           string                       `mapstructure:"directory"`
+	Enlarge             string                       `mapstructure:"enlarge"`
+	Fallback            ImageFallback                `mapstructure:"fallback"`
+	Formats             []string                     `mapstructure:"formats"`
+	GC                  ImageGC                      `mapstructure:"gc"`
+	Limits              ImageLimits                  `mapstructure:"limits"`
+	Path                string                       `mapstructure:"path"`
+	Presets             map[string]utils.ImagePreset `mapstructure:"presets"`
+	SourceCheck         string                       `mapstructure:"source_check"`
+	SourceCheckInterval time.Duration                `mapstructure:"source_check_interval"`
+	StrictParams        bool                         `mapstructure:"strict_params"`
+}
+
+// AllowedSizes restricts the direct sizes that can be requested to prevent cache-busting abuse.
+// Sizes are width-only ("640") or width and height ("640x480") entries, where each dimension
+// can also be a range with a step ("100-2000:100"). An empty list allows every size.
+// Mode is "reject", "snap" (serve the nearest allowed size) or "redirect" (redirect to it).
+type AllowedSizes struct {
+	Mode         string   `mapstructure:"mode"`
+	SignedBypass bool     `mapstructure:"signed_bypass"`
+	Sizes        []string `mapstructure:"sizes"`
+}
+
+// ImageFallback contains configuration for the placeholder image served when a source is missing.
+// Prefix rules are matched against the requested image path and the longest match wins;
+// Source is used when no rule matches. Sources are relative to the image directory.
+type ImageFallback struct {
+	MaxAge   time.Duration  `mapstructure:"max_age"`
+	Prefixes []FallbackRule `mapstructure:"prefixes"`
+	Source   string         `mapstructure:"source"`
+	Status   int            `mapstructure:"status"`
+}
+
+// FallbackRule maps a directory prefix of requested image paths to a fallback source.
+type FallbackRule struct {
+	Prefix string `mapstructure:"prefix"`
+	Source string `mapstructure:"source"`
+}
+
+// ImageGC contains configuration for the garbage collection of cached derivatives.
+// An interval of 0 disables the background collection while serving.
+// Intermediates younger than MinAge are kept, as a conversion may still be using them.
+type ImageGC struct {
+	Interval time.Duration `mapstructure:"interval"`
+	MinAge   time.Duration `mapstructure:"min_age"`
+}
+
+// ImageLimits contains resource limits protecting against oversized requests and decompression bombs.
+// A value of 0 disables the corresponding limit.
+type ImageLimits struct {
+	MaxHeight       int   `mapstructure:"max_height"`
+	MaxPixels       int64 `mapstructure:"max_pixels"`
+	MaxSourceBytes  int64 `mapstructure:"max_source_bytes"`
+	MaxSourcePixels int64 `mapstructure:"max_source_pixels"`
+	MaxWidth        int   `mapstructure:"max_width"`
 }
 
 // RateLimit contains configuration for request rate limiting.
@@ -46,6 +273,70 @@ func setDefaults() {
 	viper.SetDefault("port", "8080")
 	viper.SetDefault("public_dir", "public")
 	viper.SetDefault("secret", "")
+	viper.SetDefault("shutdown_timeout", "30s")
+
+	viper.SetDefault("access_log.format", "combined")
+	viper.SetDefault("access_log.output", "stdout")
+	viper.SetDefault("access_log.sampling", []AccessLogRule{})
+
+	viper.SetDefault("admin.path", "/admin/")
+	viper.SetDefault("admin.token", "")
+
+	viper.SetDefault("assets.cache_control", "public, max-age=31536000, immutable")
+	viper.SetDefault("assets.exclude", []string{})
+	viper.SetDefault("assets.hash_length", 8)
+	viper.SetDefault("assets.include", []string{})
+	viper.SetDefault("assets.manifest", "manifest.json")
+	viper.SetDefault("assets.stale", "redirect")
+
+	viper.SetDefault("compression.cache_dir", filepath.Join(defaultCacheDir(), "compressed"))
+	viper.SetDefault("compression.dynamic", true)
+	viper.SetDefault("compression.min_size", 1024)
+	viper.SetDefault("compression.precompressed", true)
+	viper.SetDefault("compression.types", []string{
+		"text/", "application/javascript", "application/json", "application/manifest+json",
+		"application/wasm", "application/xml", "image/svg+xml", "font/otf", "font/ttf",
+	})
+
+	for _, policy := range []string{"cors.images", "cors.public"} {
+		viper.SetDefault(policy+".allow_credentials", false)
+		viper.SetDefault(policy+".allowed_headers", []string{})
+		viper.SetDefault(policy+".allowed_methods", []string{"GET", "HEAD"})
+		viper.SetDefault(policy+".allowed_origins", []string{})
+		viper.SetDefault(policy+".exposed_headers", []string{})
+		viper.SetDefault(policy+".max_age", "0s")
+	}
+
+	viper.SetDefault("http_cache.etag", true)
+	viper.SetDefault("http_cache.last_modified", true)
+	viper.SetDefault("http_cache.errors", "")
+	viper.SetDefault("http_cache.images", "")
+	viper.SetDefault("http_cache.public", []CacheControlRule{})
+
+	viper.SetDefault("listen.socket", "")
+	viper.SetDefault("listen.socket_mode", "0660")
+
+	viper.SetDefault("metrics.path", "")
+
+	viper.SetDefault("tracing.endpoint", "")
+	viper.SetDefault("tracing.sample_rate", 1.0)
+	viper.SetDefault("tracing.service_name", "assetgoblin")
+
+	viper.SetDefault("security.content_security_policy", "")
+	viper.SetDefault("security.content_type_options", "nosniff")
+	viper.SetDefault("security.cross_origin_resource_policy", "")
+	viper.SetDefault("security.directory_listing", false)
+	viper.SetDefault("security.hidden", []string{})
+	viper.SetDefault("security.hide_dotfiles", true)
+	viper.SetDefault("security.referrer_policy", "strict-origin-when-cross-origin")
+
+	viper.SetDefault("signing.clock_skew", "30s")
+	viper.SetDefault("signing.legacy_tokens", false)
+
+	viper.SetDefault("tls.cert_file", "")
+	viper.SetDefault("tls.key_file", "")
+	viper.SetDefault("tls.min_version", "1.2")
+	viper.SetDefault("tls.redirect_port", "")
 
 	viper.SetDefault("rate_limit.limit", 0)
 	viper.SetDefault("rate_limit.ttl", "1m")
@@ -55,7 +346,26 @@ func setDefaults() {
 	viper.SetDefault("image.path", "/img/")
 	viper.SetDefault("image.directory", "assets/img")
 	viper.SetDefault("image.cache_dir", filepath.Join(defaultCacheDir(), "img"))
+	viper.SetDefault("image.cache_version", "")
 	viper.SetDefault("image.avif_through_vips", false)
+	viper.SetDefault("image.enlarge", "allow")
+	viper.SetDefault("image.strict_params", false)
+	viper.SetDefault("image.source_check", "mtime")
+	viper.SetDefault("image.source_check_interval", "0s")
+	viper.SetDefault("image.allowed_sizes.sizes", []string{})
+	viper.SetDefault("image.allowed_sizes.mode", "reject")
+	viper.SetDefault("image.allowed_sizes.signed_bypass", false)
+	viper.SetDefault("image.limits.max_width", 8192)
+	viper.SetDefault("image.limits.max_height", 8192)
+	viper.SetDefault("image.limits.max_pixels", 40000000)
+	viper.SetDefault("image.limits.max_source_pixels", 268402689)
+	viper.SetDefault("image.limits.max_source_bytes", 104857600)
+	viper.SetDefault("image.gc.interval", "0s")
+	viper.SetDefault("image.gc.min_age", "1h")
+	viper.SetDefault("image.fallback.source", "")
+	viper.SetDefault("image.fallback.prefixes", []FallbackRule{})
+	viper.SetDefault("image.fallback.status", 404)
+	viper.SetDefault("image.fallback.max_age", "1m")
 }
 
 // Load loads the configuration from a file or a previously saved gob file.
@@ -95,6 +405,66 @@ func (config *Config) Load() error {
 		return fmt.Errorf("invalid config: %w", err)
 	}
 
+	if err := config.validateFallback(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateAllowedSizes(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateSourceCheck(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateAdmin(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateHTTPCache(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateAssets(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateCORS(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateSecurity(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateSigning(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateShutdown(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateTLS(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateListen(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateMetrics(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateAccessLog(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	if err := config.validateTracing(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
 	if err := config.saveGob(); err != nil {
 		slog.Warn("Failed to save gob file", "error", err)
 	}
@@ -238,6 +238,15 @@ func TestSetDefaults(t *testing.T) {
 	if cfg.Image.AvifThroughVips != false {
 		t.Errorf("Expected default avif_through_vips false, got %v", cfg.Image.AvifThroughVips)
 	}
+	if cfg.Image.Limits.MaxWidth != 8192 || cfg.Image.Limits.MaxHeight != 8192 {
+		t.Errorf("Expected default max dimensions 8192x8192, got %dx%d", cfg.Image.Limits.MaxWidth, cfg.Image.Limits.MaxHeight)
+	}
+	if cfg.Image.Limits.MaxSourceBytes != 104857600 {
+		t.Errorf("Expected default max_source_bytes 104857600, got %d", cfg.Image.Limits.MaxSourceBytes)
+	}
+	if cfg.Image.GC.Interval != 0 || cfg.Image.GC.MinAge != time.Hour {
+		t.Errorf("Expected default gc interval 0 and min_age 1h, got %v and %v", cfg.Image.GC.Interval, cfg.Image.GC.MinAge)
+	}
 }
 
 // TestConfigLoad_SetsUsedConfigFileFromDisk ensures disk-backed config metadata is set.
@@ -4,8 +4,12 @@ import (
 	"encoding/gob"
 	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"assetgoblin/utils"
 )
@@ -65,44 +69,17 @@ func (config *Config) loadGob() error {
 	return nil
 }
 
-// normalizePresets normalizes presets by setting default Fit value and validates all preset fields.
+// normalizePresets normalizes presets by setting default Fit value and background color,
+// and validates all preset fields along with the global enlarge policy.
+// Zero values of optional numeric fields mean the adjustment is not applied.
 func (config *Config) normalizePresets() error {
-	if config.Image.Presets == nil {
-		return nil
+	validEnlarges := map[string]bool{"": true, "allow": true, "never": true, "redirect": true}
+	if !validEnlarges[config.Image.Enlarge] {
+		return fmt.Errorf("image.enlarge must be allow, never, or redirect")
 	}
 
-	validRotations := map[int]bool{0: true, 90: true, 180: true, 270: true}
-	validFlips := map[string]bool{"": true, "horizontal": true, "vertical": true, "both": true}
-	validCrops := map[string]bool{
-		"":             true,
-		"top-left":     true,
-		"top":          true,
-		"top-right":    true,
-		"left":         true,
-		"center":       true,
-		"right":        true,
-		"bottom-left":  true,
-		"bottom":       true,
-		"bottom-right": true,
-	}
-	validFilters := map[string]bool{
-		"":          true,
-		"grayscale": true,
-		"sepia":     true,
-		"blur":      true,
-		"sharpen":   true,
-		"negate":    true,
-		"edge":      true,
-		"emboss":    true,
-		"charcoal":  true,
-		"solarize":  true,
-		"normalize": true,
-		"equalize":  true,
-		"contrast":  true,
-		"paint":     true,
-		"oil":       true,
-		"sketch":    true,
-		"vignette":  true,
+	if config.Image.Presets == nil {
+		return nil
 	}
 
 	normalized := make(map[string]utils.ImagePreset)
@@ -113,31 +90,329 @@ func (config *Config) normalizePresets() error {
 		if p.Fit == "" {
 			p.Fit = "contain"
 		}
-		if !validRotations[p.Rotate] {
-			return fmt.Errorf("preset %q: rotate must be 0, 90, 180, or 270", name)
+		if err := utils.ValidateFit(p.Fit); err != nil {
+			return fmt.Errorf("preset %q: fit %w", name, err)
 		}
-		if !validFlips[p.Flip] {
-			return fmt.Errorf("preset %q: flip must be empty, horizontal, vertical, or both", name)
+		if p.Height <= 0 && (p.Fit == "fill" || p.Fit == "outside" || p.Fit == "pad") {
+			return fmt.Errorf("preset %q: height is required for fit %q", name, p.Fit)
 		}
-		if !validCrops[p.Crop] {
-			return fmt.Errorf("preset %q: invalid crop region", name)
+		if p.Background != "" {
+			color, err := utils.ParseColor(p.Background)
+			if err != nil {
+				return fmt.Errorf("preset %q: invalid background: %w", name, err)
+			}
+			p.Background = color
 		}
-		if p.Brightness < -100 || p.Brightness > 100 {
-			return fmt.Errorf("preset %q: brightness must be between -100 and 100", name)
+		if !validEnlarges[p.Enlarge] {
+			return fmt.Errorf("preset %q: enlarge must be empty, allow, never, or redirect", name)
 		}
-		if p.Contrast < -100 || p.Contrast > 100 {
-			return fmt.Errorf("preset %q: contrast must be between -100 and 100", name)
+		if err := utils.ValidateRotate(p.Rotate); err != nil {
+			return fmt.Errorf("preset %q: rotate %w", name, err)
+		}
+		if err := utils.ValidateFlip(p.Flip); err != nil {
+			return fmt.Errorf("preset %q: flip %w", name, err)
+		}
+		if err := utils.ValidateCrop(p.Crop); err != nil {
+			return fmt.Errorf("preset %q: crop %w", name, err)
+		}
+		if p.Extract != "" {
+			if _, err := utils.ParseExtract(p.Extract); err != nil {
+				return fmt.Errorf("preset %q: %w", name, err)
+			}
 		}
-		if p.Gamma < 0.1 || p.Gamma > 10.0 {
-			return fmt.Errorf("preset %q: gamma must be between 0.1 and 10.0", name)
+		if err := utils.ValidateBrightness(p.Brightness); err != nil {
+			return fmt.Errorf("preset %q: brightness %w", name, err)
 		}
+		if err := utils.ValidateContrast(p.Contrast); err != nil {
+			return fmt.Errorf("preset %q: contrast %w", name, err)
+		}
+		if p.Gamma != 0 {
+			if err := utils.ValidateGamma(p.Gamma); err != nil {
+				return fmt.Errorf("preset %q: gamma %w", name, err)
+			}
+		}
+		filters := make([]string, 0, len(p.Filters))
 		for _, f := range p.Filters {
-			if !validFilters[f] {
-				return fmt.Errorf("preset %q: invalid filter %q", name, f)
+			if f == "" {
+				continue
+			}
+			if err := utils.ValidateFilter(f); err != nil {
+				return fmt.Errorf("preset %q: %w", name, err)
 			}
+			filters = append(filters, f)
+		}
+		if p.Filters != nil {
+			p.Filters = filters
 		}
 		normalized[name] = p
 	}
 	config.Image.Presets = normalized
 	return nil
 }
+
+// validateFallback validates the fallback image status code and source paths.
+// Sources must be local paths inside the image directory.
+func (config *Config) validateFallback() error {
+	fallback := config.Image.Fallback
+
+	if fallback.Status != 0 && fallback.Status != 200 && fallback.Status != 404 {
+		return fmt.Errorf("image.fallback.status must be 200 or 404")
+	}
+	if fallback.Source != "" && !filepath.IsLocal(fallback.Source) {
+		return fmt.Errorf("image.fallback.source %q must be relative to the image directory", fallback.Source)
+	}
+	for _, rule := range fallback.Prefixes {
+		if rule.Source == "" || !filepath.IsLocal(rule.Source) {
+			return fmt.Errorf("image.fallback.prefixes: source %q for prefix %q must be relative to the image directory", rule.Source, rule.Prefix)
+		}
+	}
+
+	return nil
+}
+
+// validateAllowedSizes validates the allowed size entries and the mode applied to other sizes.
+func (config *Config) validateAllowedSizes() error {
+	allowed := config.Image.AllowedSizes
+
+	if allowed.Mode != "" && allowed.Mode != "reject" && allowed.Mode != "snap" && allowed.Mode != "redirect" {
+		return fmt.Errorf("image.allowed_sizes.mode must be reject, snap, or redirect")
+	}
+	for _, size := range allowed.Sizes {
+		if _, err := utils.ParseSizeSpec(size); err != nil {
+			return fmt.Errorf("image.allowed_sizes.sizes: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validateSourceCheck checks the source check mode and interval.
+func (config *Config) validateSourceCheck() error {
+	check := config.Image.SourceCheck
+	if check != "" && check != "off" && check != "mtime" && check != "hash" {
+		return fmt.Errorf("image.source_check must be off, mtime, or hash")
+	}
+	if config.Image.SourceCheckInterval < 0 {
+		return fmt.Errorf("image.source_check_interval must not be negative")
+	}
+	return nil
+}
+
+// validateAdmin checks that the admin API path is usable when the API is enabled.
+func (config *Config) validateAdmin() error {
+	if config.Admin.Token == "" {
+		return nil
+	}
+
+	path := config.Admin.Path
+	if !strings.HasPrefix(path, "/") || !strings.HasSuffix(path, "/") || path == "/" {
+		return fmt.Errorf("admin.path must start and end with a slash and must not be the root path")
+	}
+	if imagePath := config.Image.Path; imagePath != "" && (strings.HasPrefix(path, imagePath) || strings.HasPrefix(imagePath, path)) {
+		return fmt.Errorf("admin.path must not overlap image.path")
+	}
+	return nil
+}
+
+// validateHTTPCache checks that the public Cache-Control rules have valid patterns.
+func (config *Config) validateHTTPCache() error {
+	for _, rule := range config.HTTPCache.Public {
+		if _, err := path.Match(rule.Pattern, ""); err != nil || rule.Pattern == "" {
+			return fmt.Errorf("http_cache.public: invalid pattern %q", rule.Pattern)
+		}
+	}
+	return nil
+}
+
+// validateAssets checks the hashed asset settings.
+func (config *Config) validateAssets() error {
+	assets := config.Assets
+
+	if assets.HashLength < 4 || assets.HashLength > 64 {
+		return fmt.Errorf("assets.hash_length must be between 4 and 64")
+	}
+	if assets.Stale != "redirect" && assets.Stale != "not_found" {
+		return fmt.Errorf("assets.stale must be redirect or not_found")
+	}
+	if assets.Manifest == "" || !filepath.IsLocal(assets.Manifest) {
+		return fmt.Errorf("assets.manifest %q must be relative to the public directory", assets.Manifest)
+	}
+	for _, pattern := range append(slices.Clone(assets.Include), assets.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("assets: invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// validateCORS checks the origin patterns, methods and max age of both CORS policies.
+func (config *Config) validateCORS() error {
+	policies := []struct {
+		name   string
+		policy CORSPolicy
+	}{
+		{"cors.images", config.CORS.Images},
+		{"cors.public", config.CORS.Public},
+	}
+	for _, p := range policies {
+		for _, origin := range p.policy.AllowedOrigins {
+			if _, err := path.Match(origin, ""); err != nil || (origin != "*" && !strings.Contains(origin, "://")) {
+				return fmt.Errorf("%s.allowed_origins: invalid origin %q", p.name, origin)
+			}
+			if origin == "*" && p.policy.AllowCredentials {
+				return fmt.Errorf("%s.allow_credentials must not be combined with the origin \"*\"", p.name)
+			}
+		}
+		for _, method := range p.policy.AllowedMethods {
+			if method == "" || strings.ToUpper(method) != method || strings.ContainsAny(method, " ,") {
+				return fmt.Errorf("%s.allowed_methods: invalid method %q", p.name, method)
+			}
+		}
+		if p.policy.MaxAge < 0 {
+			return fmt.Errorf("%s.max_age must not be negative", p.name)
+		}
+	}
+	return nil
+}
+
+// validateSecurity checks the hidden patterns and the values of the security headers with a fixed set of values.
+func (config *Config) validateSecurity() error {
+	security := config.Security
+
+	for _, pattern := range security.Hidden {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("security.hidden: invalid pattern %q", pattern)
+		}
+	}
+	if security.ContentTypeOptions != "" && security.ContentTypeOptions != "nosniff" {
+		return fmt.Errorf("security.content_type_options must be nosniff or empty")
+	}
+	if !slices.Contains([]string{"", "same-site", "same-origin", "cross-origin"}, security.CrossOriginResourcePolicy) {
+		return fmt.Errorf("security.cross_origin_resource_policy must be same-site, same-origin, cross-origin, or empty")
+	}
+	referrerPolicies := []string{
+		"no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin", "same-origin",
+		"strict-origin", "strict-origin-when-cross-origin", "unsafe-url",
+	}
+	if security.ReferrerPolicy != "" {
+		for policy := range strings.SplitSeq(security.ReferrerPolicy, ",") {
+			if !slices.Contains(referrerPolicies, strings.TrimSpace(policy)) {
+				return fmt.Errorf("security.referrer_policy: invalid policy %q", strings.TrimSpace(policy))
+			}
+		}
+	}
+	return nil
+}
+
+// validateSigning checks that the clock skew allowed for expired tokens is not negative.
+func (config *Config) validateSigning() error {
+	if config.Signing.ClockSkew < 0 {
+		return fmt.Errorf("signing.clock_skew must not be negative")
+	}
+	return nil
+}
+
+// validateShutdown checks that the graceful shutdown deadline is not negative.
+func (config *Config) validateShutdown() error {
+	if config.ShutdownTimeout < 0 {
+		return fmt.Errorf("shutdown_timeout must not be negative")
+	}
+	return nil
+}
+
+// validateTLS checks that certificate and key are set together and the TLS settings are usable.
+func (config *Config) validateTLS() error {
+	t := config.TLS
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("tls.cert_file and tls.key_file must be set together")
+	}
+	if t.MinVersion != "1.2" && t.MinVersion != "1.3" {
+		return fmt.Errorf("tls.min_version must be 1.2 or 1.3")
+	}
+	if t.RedirectPort != "" {
+		if !t.Enabled() {
+			return fmt.Errorf("tls.redirect_port requires tls.cert_file and tls.key_file")
+		}
+		if t.RedirectPort == config.Port {
+			return fmt.Errorf("tls.redirect_port must differ from port")
+		}
+	}
+	return nil
+}
+
+// validateListen checks that the socket mode is an octal permission.
+func (config *Config) validateListen() error {
+	if _, err := config.Listen.Mode(); err != nil {
+		return fmt.Errorf("listen.socket_mode %q must be an octal permission like 0660", config.Listen.SocketMode)
+	}
+	return nil
+}
+
+// validateMetrics checks that the metrics path is absolute and outside the image path.
+func (config *Config) validateMetrics() error {
+	metricsPath := config.Metrics.Path
+	if metricsPath == "" {
+		return nil
+	}
+	if !strings.HasPrefix(metricsPath, "/") || metricsPath == "/" {
+		return fmt.Errorf("metrics.path %q must start with a slash and not be the root path", metricsPath)
+	}
+	if config.Image.Path != "" && strings.HasPrefix(metricsPath, config.Image.Path) {
+		return fmt.Errorf("metrics.path %q must not be inside image.path", metricsPath)
+	}
+	return nil
+}
+
+// validateAccessLog checks the access log format, output and sampling rules.
+func (config *Config) validateAccessLog() error {
+	accessLog := config.AccessLog
+
+	if !slices.Contains([]string{"off", "common", "combined", "json", "logfmt"}, accessLog.Format) {
+		return fmt.Errorf("access_log.format must be off, common, combined, json, or logfmt")
+	}
+	if accessLog.Format != "off" && accessLog.Output == "" {
+		return fmt.Errorf("access_log.output must be stdout, stderr, or a file path")
+	}
+	for _, rule := range accessLog.Sampling {
+		if rule.Rate < 0 || rule.Rate > 1 {
+			return fmt.Errorf("access_log.sampling: rate %v must be between 0 and 1", rule.Rate)
+		}
+		if !isStatusPattern(rule.Status) {
+			return fmt.Errorf("access_log.sampling: invalid status %q", rule.Status)
+		}
+	}
+	return nil
+}
+
+// isStatusPattern reports whether pattern is empty, a status code like "404" or a class like "4xx".
+func isStatusPattern(pattern string) bool {
+	if pattern == "" {
+		return true
+	}
+	if len(pattern) != 3 || pattern[0] < '1' || pattern[0] > '5' {
+		return false
+	}
+	if strings.EqualFold(pattern[1:], "xx") {
+		return true
+	}
+	return pattern[1] >= '0' && pattern[1] <= '9' && pattern[2] >= '0' && pattern[2] <= '9'
+}
+
+// validateTracing checks that the trace endpoint is an HTTP URL and the sample rate a fraction.
+func (config *Config) validateTracing() error {
+	tracing := config.Tracing
+	if tracing.Endpoint == "" {
+		return nil
+	}
+	if endpoint, err := url.Parse(tracing.Endpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return fmt.Errorf("tracing.endpoint %q must be an http or https URL", tracing.Endpoint)
+	}
+	if tracing.SampleRate < 0 || tracing.SampleRate > 1 {
+		return fmt.Errorf("tracing.sample_rate must be between 0 and 1")
+	}
+	if tracing.ServiceName == "" {
+		return fmt.Errorf("tracing.service_name must not be empty")
+	}
+	return nil
+}
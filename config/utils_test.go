@@ -3,7 +3,9 @@ package config
 import (
 	"assetgoblin/utils"
 	"os"
+	"slices"
 	"testing"
+	"time"
 )
 
 // TestConfig_SaveGob verifies gob serialization writes a cache file.
@@ -208,3 +210,479 @@ func TestRemoveGobFile(t *testing.T) {
 		t.Fatalf("RemoveGobFile() should not fail for missing file: %v", err)
 	}
 }
+
+// TestConfig_ValidateFallback verifies fallback status and source validation.
+func TestConfig_ValidateFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback ImageFallback
+		wantErr  bool
+	}{
+		{
+			name:     "empty fallback",
+			fallback: ImageFallback{Status: 404},
+			wantErr:  false,
+		},
+		{
+			name: "valid fallback with prefixes",
+			fallback: ImageFallback{
+				Source:   "placeholder.png",
+				Prefixes: []FallbackRule{{Prefix: "products/", Source: "products/placeholder.png"}},
+				Status:   200,
+			},
+			wantErr: false,
+		},
+		{
+			name:     "invalid status",
+			fallback: ImageFallback{Source: "placeholder.png", Status: 302},
+			wantErr:  true,
+		},
+		{
+			name:     "source outside image directory",
+			fallback: ImageFallback{Source: "../placeholder.png", Status: 404},
+			wantErr:  true,
+		},
+		{
+			name: "prefix without source",
+			fallback: ImageFallback{
+				Prefixes: []FallbackRule{{Prefix: "products/"}},
+				Status:   404,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Image: Image{Fallback: tt.fallback}}
+			if err := cfg.validateFallback(); (err != nil) != tt.wantErr {
+				t.Errorf("validateFallback() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfig_NormalizePresets verifies preset defaults and validation errors.
+func TestConfig_NormalizePresets(t *testing.T) {
+	tests := []struct {
+		name    string
+		preset  utils.ImagePreset
+		want    utils.ImagePreset
+		wantErr bool
+	}{
+		{
+			name:   "default fit",
+			preset: utils.ImagePreset{Width: 100, Gamma: 1},
+			want:   utils.ImagePreset{Width: 100, Fit: "contain", Gamma: 1},
+		},
+		{
+			name:   "pad with normalized background",
+			preset: utils.ImagePreset{Width: 100, Height: 50, Fit: "pad", Background: "#FFF", Gamma: 1},
+			want:   utils.ImagePreset{Width: 100, Height: 50, Fit: "pad", Background: "ffffff", Gamma: 1},
+		},
+		{
+			name:   "unset gamma",
+			preset: utils.ImagePreset{Width: 100},
+			want:   utils.ImagePreset{Width: 100, Fit: "contain"},
+		},
+		{
+			name:    "gamma out of range",
+			preset:  utils.ImagePreset{Width: 100, Gamma: 20},
+			wantErr: true,
+		},
+		{
+			name:    "gamma below range",
+			preset:  utils.ImagePreset{Width: 100, Gamma: 0.05},
+			wantErr: true,
+		},
+		{
+			name:   "invert filter",
+			preset: utils.ImagePreset{Width: 100, Filters: []string{"invert"}},
+			want:   utils.ImagePreset{Width: 100, Fit: "contain", Filters: []string{"invert"}},
+		},
+		{
+			name:   "empty filters dropped",
+			preset: utils.ImagePreset{Width: 100, Filters: []string{"", "grayscale", ""}},
+			want:   utils.ImagePreset{Width: 100, Fit: "contain", Filters: []string{"grayscale"}},
+		},
+		{
+			name:    "unknown filter",
+			preset:  utils.ImagePreset{Width: 100, Filters: []string{"watercolor"}},
+			wantErr: true,
+		},
+		{
+			name:    "missing width",
+			preset:  utils.ImagePreset{Gamma: 1},
+			wantErr: true,
+		},
+		{
+			name:    "unknown fit",
+			preset:  utils.ImagePreset{Width: 100, Fit: "stretch", Gamma: 1},
+			wantErr: true,
+		},
+		{
+			name:    "pad without height",
+			preset:  utils.ImagePreset{Width: 100, Fit: "pad", Gamma: 1},
+			wantErr: true,
+		},
+		{
+			name:    "invalid background",
+			preset:  utils.ImagePreset{Width: 100, Height: 50, Fit: "pad", Background: "nope", Gamma: 1},
+			wantErr: true,
+		},
+		{
+			name:    "invalid enlarge",
+			preset:  utils.ImagePreset{Width: 100, Enlarge: "sometimes", Gamma: 1},
+			wantErr: true,
+		},
+		{
+			name:    "invalid extract",
+			preset:  utils.ImagePreset{Width: 100, Extract: "1,2,3", Gamma: 1},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Image: Image{Presets: map[string]utils.ImagePreset{"p": tt.preset}}}
+			err := cfg.normalizePresets()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizePresets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				got := cfg.Image.Presets["p"]
+				if got.Fit != tt.want.Fit || got.Background != tt.want.Background || !slices.Equal(got.Filters, tt.want.Filters) {
+					t.Errorf("normalizePresets() = %+v, want %+v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// TestConfig_ValidateAllowedSizes verifies allowed size entries and mode validation.
+func TestConfig_ValidateAllowedSizes(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed AllowedSizes
+		wantErr bool
+	}{
+		{name: "empty allowlist", allowed: AllowedSizes{Mode: "reject"}},
+		{name: "valid entries", allowed: AllowedSizes{Sizes: []string{"640", "640x480", "100-2000:100"}, Mode: "snap"}},
+		{name: "invalid mode", allowed: AllowedSizes{Mode: "ignore"}, wantErr: true},
+		{name: "invalid entry", allowed: AllowedSizes{Sizes: []string{"big"}, Mode: "redirect"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Image: Image{AllowedSizes: tt.allowed}}
+			if err := cfg.validateAllowedSizes(); (err != nil) != tt.wantErr {
+				t.Errorf("validateAllowedSizes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfig_ValidateSourceCheck verifies source check modes and intervals are validated.
+func TestConfig_ValidateSourceCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		check    string
+		interval time.Duration
+		wantErr  bool
+	}{
+		{name: "default mode", check: ""},
+		{name: "hash with interval", check: "hash", interval: time.Minute},
+		{name: "invalid mode", check: "always", wantErr: true},
+		{name: "negative interval", check: "mtime", interval: -time.Second, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Image: Image{SourceCheck: tt.check, SourceCheckInterval: tt.interval}}
+			if err := cfg.validateSourceCheck(); (err != nil) != tt.wantErr {
+				t.Errorf("validateSourceCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfig_ValidateAdmin verifies the admin path is checked only when the API is enabled.
+func TestConfig_ValidateAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		admin   Admin
+		wantErr bool
+	}{
+		{name: "disabled", admin: Admin{Path: "admin"}},
+		{name: "enabled", admin: Admin{Path: "/admin/", Token: "secret"}},
+		{name: "missing slashes", admin: Admin{Path: "admin", Token: "secret"}, wantErr: true},
+		{name: "root path", admin: Admin{Path: "/", Token: "secret"}, wantErr: true},
+		{name: "inside image path", admin: Admin{Path: "/img/admin/", Token: "secret"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Admin: tt.admin, Image: Image{Path: "/img/"}}
+			if err := cfg.validateAdmin(); (err != nil) != tt.wantErr {
+				t.Errorf("validateAdmin() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfig_ValidateHTTPCache verifies public Cache-Control rules require valid patterns.
+func TestConfig_ValidateHTTPCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []CacheControlRule
+		wantErr bool
+	}{
+		{name: "no rules"},
+		{name: "valid patterns", rules: []CacheControlRule{{Pattern: "*.html", CacheControl: "no-cache"}, {Pattern: "assets/*"}}},
+		{name: "empty pattern", rules: []CacheControlRule{{CacheControl: "no-cache"}}, wantErr: true},
+		{name: "malformed pattern", rules: []CacheControlRule{{Pattern: "[", CacheControl: "no-cache"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{HTTPCache: HTTPCache{Public: tt.rules}}
+			if err := cfg.validateHTTPCache(); (err != nil) != tt.wantErr {
+				t.Errorf("validateHTTPCache() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfig_ValidateAssets verifies hashed asset settings are validated.
+func TestConfig_ValidateAssets(t *testing.T) {
+	valid := Assets{HashLength: 8, Stale: "redirect", Manifest: "manifest.json"}
+	tests := []struct {
+		name    string
+		modify  func(assets *Assets)
+		wantErr bool
+	}{
+		{name: "defaults", modify: func(*Assets) {}},
+		{name: "not found for stale hashes", modify: func(a *Assets) { a.Stale = "not_found" }},
+		{name: "short hash", modify: func(a *Assets) { a.HashLength = 2 }, wantErr: true},
+		{name: "unknown stale mode", modify: func(a *Assets) { a.Stale = "ignore" }, wantErr: true},
+		{name: "manifest outside public directory", modify: func(a *Assets) { a.Manifest = "../manifest.json" }, wantErr: true},
+		{name: "malformed pattern", modify: func(a *Assets) { a.Exclude = []string{"["} }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assets := valid
+			tt.modify(&assets)
+			cfg := &Config{Assets: assets}
+			if err := cfg.validateAssets(); (err != nil) != tt.wantErr {
+				t.Errorf("validateAssets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfig_ValidateShutdown verifies negative shutdown deadlines are rejected.
+func TestConfig_ValidateShutdown(t *testing.T) {
+	if err := (&Config{ShutdownTimeout: 30 * time.Second}).validateShutdown(); err != nil {
+		t.Errorf("validateShutdown() error = %v, want nil", err)
+	}
+	if err := (&Config{ShutdownTimeout: -time.Second}).validateShutdown(); err == nil {
+		t.Errorf("validateShutdown() with negative timeout = nil, want error")
+	}
+}
+
+// TestConfig_ValidateTLS verifies certificate pairs, versions and the redirect port are validated.
+func TestConfig_ValidateTLS(t *testing.T) {
+	tests := []struct {
+		name    string
+		tls     TLS
+		wantErr bool
+	}{
+		{name: "disabled", tls: TLS{MinVersion: "1.2"}},
+		{name: "enabled with redirect", tls: TLS{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.3", RedirectPort: "8081"}},
+		{name: "missing key", tls: TLS{CertFile: "cert.pem", MinVersion: "1.2"}, wantErr: true},
+		{name: "invalid version", tls: TLS{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.0"}, wantErr: true},
+		{name: "redirect without tls", tls: TLS{MinVersion: "1.2", RedirectPort: "8081"}, wantErr: true},
+		{name: "redirect on server port", tls: TLS{CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.2", RedirectPort: "8080"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Port: "8080", TLS: tt.tls}
+			if err := cfg.validateTLS(); (err != nil) != tt.wantErr {
+				t.Errorf("validateTLS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestListen_Mode verifies socket modes are parsed as octal permissions.
+func TestListen_Mode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{mode: "0660", want: 0660},
+		{mode: "777", want: 0777},
+		{mode: "", wantErr: true},
+		{mode: "0999", wantErr: true},
+		{mode: "01777", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := Listen{SocketMode: tt.mode}.Mode()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Mode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Mode() = %o, want %o", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestConfig_ValidateMetrics verifies the metrics path is checked unless the endpoint is disabled.
+func TestConfig_ValidateMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{name: "disabled", path: ""},
+		{name: "enabled", path: "/metrics"},
+		{name: "relative", path: "metrics", wantErr: true},
+		{name: "root path", path: "/", wantErr: true},
+		{name: "inside image path", path: "/img/metrics", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Metrics: Metrics{Path: tt.path}, Image: Image{Path: "/img/"}}
+			if err := cfg.validateMetrics(); (err != nil) != tt.wantErr {
+				t.Errorf("validateMetrics() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfig_ValidateAccessLog verifies formats, outputs and sampling rules are validated.
+func TestConfig_ValidateAccessLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		accessLog AccessLog
+		wantErr   bool
+	}{
+		{name: "off", accessLog: AccessLog{Format: "off"}},
+		{name: "combined to stdout", accessLog: AccessLog{Format: "combined", Output: "stdout"}},
+		{name: "sampling", accessLog: AccessLog{Format: "json", Output: "access.log", Sampling: []AccessLogRule{
+			{Prefix: "/healthz", Rate: 0}, {Status: "2xx", Rate: 0.1}, {Status: "404", Rate: 1},
+		}}},
+		{name: "unknown format", accessLog: AccessLog{Format: "xml", Output: "stdout"}, wantErr: true},
+		{name: "missing output", accessLog: AccessLog{Format: "common"}, wantErr: true},
+		{name: "rate above 1", accessLog: AccessLog{Format: "common", Output: "stdout", Sampling: []AccessLogRule{{Rate: 2}}}, wantErr: true},
+		{name: "invalid status", accessLog: AccessLog{Format: "common", Output: "stdout", Sampling: []AccessLogRule{{Status: "2x", Rate: 1}}}, wantErr: true},
+		{name: "signed status", accessLog: AccessLog{Format: "common", Output: "stdout", Sampling: []AccessLogRule{{Status: "4+1", Rate: 1}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{AccessLog: tt.accessLog}
+			if err := cfg.validateAccessLog(); (err != nil) != tt.wantErr {
+				t.Errorf("validateAccessLog() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfig_ValidateTracing verifies the endpoint, sample rate and service name are validated when enabled.
+func TestConfig_ValidateTracing(t *testing.T) {
+	tests := []struct {
+		name    string
+		tracing Tracing
+		wantErr bool
+	}{
+		{name: "disabled", tracing: Tracing{SampleRate: 5}},
+		{name: "enabled", tracing: Tracing{Endpoint: "http://localhost:4318/v1/traces", SampleRate: 0.5, ServiceName: "assetgoblin"}},
+		{name: "invalid endpoint", tracing: Tracing{Endpoint: "localhost:4318", SampleRate: 1, ServiceName: "assetgoblin"}, wantErr: true},
+		{name: "invalid sample rate", tracing: Tracing{Endpoint: "http://localhost:4318/v1/traces", SampleRate: 1.5, ServiceName: "assetgoblin"}, wantErr: true},
+		{name: "missing service name", tracing: Tracing{Endpoint: "http://localhost:4318/v1/traces", SampleRate: 1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Tracing: tt.tracing}
+			if err := cfg.validateTracing(); (err != nil) != tt.wantErr {
+				t.Errorf("validateTracing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfig_ValidateCORS verifies origin patterns, methods, credentials and max age of both policies are validated.
+func TestConfig_ValidateCORS(t *testing.T) {
+	tests := []struct {
+		name    string
+		cors    CORS
+		wantErr bool
+	}{
+		{name: "disabled", cors: CORS{}},
+		{name: "any origin", cors: CORS{Images: CORSPolicy{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET", "HEAD"}}}},
+		{name: "wildcard subdomain with credentials", cors: CORS{Public: CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}, AllowCredentials: true, MaxAge: time.Hour}}},
+		{name: "origin without scheme", cors: CORS{Images: CORSPolicy{AllowedOrigins: []string{"example.com"}}}, wantErr: true},
+		{name: "malformed pattern", cors: CORS{Public: CORSPolicy{AllowedOrigins: []string{"https://[example.com"}}}, wantErr: true},
+		{name: "any origin with credentials", cors: CORS{Images: CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}}, wantErr: true},
+		{name: "lowercase method", cors: CORS{Public: CORSPolicy{AllowedMethods: []string{"get"}}}, wantErr: true},
+		{name: "negative max age", cors: CORS{Images: CORSPolicy{MaxAge: -time.Second}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{CORS: tt.cors}
+			if err := cfg.validateCORS(); (err != nil) != tt.wantErr {
+				t.Errorf("validateCORS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfig_ValidateSecurity verifies hidden patterns and security header values are validated.
+func TestConfig_ValidateSecurity(t *testing.T) {
+	tests := []struct {
+		name     string
+		security Security
+		wantErr  bool
+	}{
+		{name: "defaults", security: Security{ContentTypeOptions: "nosniff", ReferrerPolicy: "strict-origin-when-cross-origin", HideDotfiles: true}},
+		{name: "all headers", security: Security{
+			ContentSecurityPolicy: "default-src 'self'", ContentTypeOptions: "nosniff",
+			CrossOriginResourcePolicy: "cross-origin", ReferrerPolicy: "no-referrer, strict-origin", Hidden: []string{"*.bak", "private/*"},
+		}},
+		{name: "empty headers", security: Security{}},
+		{name: "invalid pattern", security: Security{Hidden: []string{"[a"}}, wantErr: true},
+		{name: "empty pattern", security: Security{Hidden: []string{""}}, wantErr: true},
+		{name: "invalid content type options", security: Security{ContentTypeOptions: "sniff"}, wantErr: true},
+		{name: "invalid resource policy", security: Security{CrossOriginResourcePolicy: "anyone"}, wantErr: true},
+		{name: "invalid referrer policy", security: Security{ReferrerPolicy: "strict-origin, always"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Security: tt.security}
+			if err := cfg.validateSecurity(); (err != nil) != tt.wantErr {
+				t.Errorf("validateSecurity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestConfig_ValidateSigning verifies negative clock skews are rejected.
+func TestConfig_ValidateSigning(t *testing.T) {
+	if err := (&Config{Signing: Signing{ClockSkew: 30 * time.Second}}).validateSigning(); err != nil {
+		t.Errorf("validateSigning() error = %v, want nil", err)
+	}
+	if err := (&Config{Signing: Signing{ClockSkew: -time.Second}}).validateSigning(); err == nil {
+		t.Errorf("validateSigning() with negative clock skew = nil, want error")
+	}
+}
@@ -0,0 +1,127 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cacheSchemaVersion is the version of the transform spec schema.
+// Bump it whenever the meaning of a spec changes, so derivatives produced under
+// the old semantics are no longer hit.
+const cacheSchemaVersion = 1
+
+// sidecarExt is the extension of the sidecar file stored next to each derivative.
+const sidecarExt = ".json"
+
+// transformSpec is the canonical description of a derivative.
+// Its JSON serialization is hashed into the cache file name, so every field that
+// affects the output must be part of it, and fields that do not apply are left empty.
+type transformSpec struct {
+	Version    int      `json:"version"`
+	Namespace  string   `json:"namespace,omitempty"`
+	Preset     string   `json:"preset,omitempty"`
+	Format     string   `json:"format"`
+	Resize     bool     `json:"resize"`
+	Width      int      `json:"width,omitempty"`
+	Height     int      `json:"height,omitempty"`
+	Fit        string   `json:"fit,omitempty"`
+	Background string   `json:"background,omitempty"`
+	Extract    []int    `json:"extract,omitempty"`
+	Crop       string   `json:"crop,omitempty"`
+	Rotate     int      `json:"rotate,omitempty"`
+	Flip       string   `json:"flip,omitempty"`
+	Brightness float64  `json:"brightness,omitempty"`
+	Contrast   float64  `json:"contrast,omitempty"`
+	Gamma      float64  `json:"gamma,omitempty"`
+	Filters    []string `json:"filters,omitempty"`
+}
+
+// cacheEntry is the content of a sidecar file describing a derivative.
+type cacheEntry struct {
+	Key           string        `json:"key"`
+	Source        string        `json:"source"`
+	SourceModTime time.Time     `json:"source_mod_time"`
+	SourceSize    int64         `json:"source_size"`
+	SourceHash    string        `json:"source_hash,omitempty"`
+	Spec          transformSpec `json:"spec"`
+	Created       time.Time     `json:"created"`
+}
+
+// newTransformSpec builds the canonical spec of a derivative in the given format.
+// The preset name is empty for direct sizes.
+func (s *Service) newTransformSpec(preset, format string, parts sizeParts) transformSpec {
+	spec := transformSpec{
+		Version:    cacheSchemaVersion,
+		Namespace:  s.Config.CacheVersion,
+		Preset:     preset,
+		Format:     strings.TrimPrefix(strings.ToLower(format), "."),
+		Resize:     parts.hasSize,
+		Crop:       parts.crop,
+		Rotate:     parts.rotate,
+		Flip:       parts.flip,
+		Brightness: parts.brightness,
+		Contrast:   parts.contrast,
+		Filters:    parts.filters,
+	}
+
+	if parts.hasSize {
+		spec.Width = parts.width
+		spec.Height = parts.height
+		spec.Fit = string(parts.fit)
+		if parts.fit == FitModePad {
+			spec.Background = background(parts)
+		}
+	}
+	if parts.extract != nil {
+		spec.Extract = parts.extractPx[:]
+	}
+	if parts.gamma > 0 && parts.gamma != 1.0 {
+		spec.Gamma = parts.gamma
+	}
+
+	return spec
+}
+
+// key returns the cache key of the spec: a hex-encoded hash of its JSON serialization.
+func (spec transformSpec) key() string {
+	data, _ := json.Marshal(spec)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// writeSidecar stores the entry next to the derivative at path.
+func writeSidecar(path string, entry cacheEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode cache entry: %w", err)
+	}
+	if err = os.WriteFile(sidecarPath(path), data, 0644); err != nil {
+		return fmt.Errorf("unable to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// readSidecar loads the entry stored next to the derivative at path.
+func readSidecar(path string) (cacheEntry, error) {
+	var entry cacheEntry
+
+	data, err := os.ReadFile(sidecarPath(path))
+	if err != nil {
+		return entry, fmt.Errorf("unable to read cache entry: %w", err)
+	}
+	if err = json.Unmarshal(data, &entry); err != nil {
+		return entry, fmt.Errorf("unable to decode cache entry: %w", err)
+	}
+	return entry, nil
+}
+
+// sidecarPath returns the sidecar file path of the derivative at path.
+func sidecarPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + sidecarExt
+}
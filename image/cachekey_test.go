@@ -0,0 +1,186 @@
+package image
+
+import (
+	"assetgoblin/config"
+	"assetgoblin/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTransformSpec_Key verifies cache keys are stable, distinct and filesystem friendly.
+func TestTransformSpec_Key(t *testing.T) {
+	service := &Service{Config: &config.Image{}}
+	parts := sizeParts{width: 640, height: 480, fit: FitModeCover, hasSize: true, rotate: 90, filters: []string{"grayscale", "blur"}}
+
+	key := service.newTransformSpec("", ".JPG", parts).key()
+	if len(key) != 32 {
+		t.Errorf("key() length = %d, want 32", len(key))
+	}
+	if again := service.newTransformSpec("", ".jpg", parts).key(); again != key {
+		t.Errorf("key() = %q, then %q; want stable keys", key, again)
+	}
+
+	reordered := parts
+	reordered.filters = []string{"blur", "grayscale"}
+	variants := map[string]transformSpec{
+		"preset":         service.newTransformSpec("thumbnail", ".jpg", parts),
+		"format":         service.newTransformSpec("", ".png", parts),
+		"filter order":   service.newTransformSpec("", ".jpg", reordered),
+		"cache version":  (&Service{Config: &config.Image{CacheVersion: "2"}}).newTransformSpec("", ".jpg", parts),
+		"schema version": func() transformSpec { spec := service.newTransformSpec("", ".jpg", parts); spec.Version++; return spec }(),
+	}
+	for name, spec := range variants {
+		if spec.key() == key {
+			t.Errorf("key() for different %s equals the original key", name)
+		}
+	}
+
+	unsized := sizeParts{width: 4000}
+	if service.newTransformSpec("", ".jpg", unsized).key() != service.newTransformSpec("", ".jpg", sizeParts{width: 5000}).key() {
+		t.Errorf("key() differs for copies without resize")
+	}
+	if gamma := service.newTransformSpec("", ".jpg", sizeParts{gamma: 1}); gamma.key() != service.newTransformSpec("", ".jpg", sizeParts{}).key() {
+		t.Errorf("key() differs for neutral gamma")
+	}
+}
+
+// TestSidecar verifies sidecar files round-trip next to derivatives.
+func TestSidecar(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0123.jpg")
+	entry := cacheEntry{Key: "0123", Source: "photos/cat.png", Spec: transformSpec{Version: cacheSchemaVersion, Format: "jpg"}}
+
+	if err := writeSidecar(path, entry); err != nil {
+		t.Fatalf("writeSidecar() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "0123.json")); err != nil {
+		t.Fatalf("sidecar not written next to derivative: %v", err)
+	}
+
+	got, err := readSidecar(path)
+	if err != nil {
+		t.Fatalf("readSidecar() error = %v", err)
+	}
+	if got.Key != entry.Key || got.Source != entry.Source || got.Spec.Format != "jpg" {
+		t.Errorf("readSidecar() = %+v, want %+v", got, entry)
+	}
+}
+
+// TestService_Serve_CachedKey verifies Serve looks up derivatives by their hashed spec key.
+func TestService_Serve_CachedKey(t *testing.T) {
+	testDir := t.TempDir()
+	cacheDir := t.TempDir()
+	createEmptyFile(t, filepath.Join(testDir, "test.jpg"))
+
+	service := &Service{
+		Config: &config.Image{
+			Directory: testDir,
+			Presets:   map[string]utils.ImagePreset{"thumbnail": {Width: 100, Fit: "contain"}},
+			CacheDir:  cacheDir,
+			Formats:   []string{"jpg"},
+		},
+	}
+
+	_, parts, _ := parseSize("thumbnail", "", service.Config.Presets)
+	parts.rotate = 90
+	writeCachedImage(t, service, testDir, cacheDir, "test.jpg", "thumbnail", ".jpg", parts, "cached")
+
+	req := httptest.NewRequest(http.MethodGet, "/img/thumbnail/test.jpg?rotate=90", nil)
+	rec := httptest.NewRecorder()
+	service.Serve(rec, req)
+
+	if status := rec.Result().StatusCode; status != http.StatusOK {
+		t.Fatalf("Serve() = %d, want %d", status, http.StatusOK)
+	}
+	if body := rec.Body.String(); body != "cached" {
+		t.Errorf("body = %q, want %q", body, "cached")
+	}
+}
+
+// writeCachedImage stores body as the derivative Serve would produce for the given spec inputs,
+// along with a sidecar recording the current state of the source, relative to imageDir.
+func writeCachedImage(t *testing.T, service *Service, imageDir, cacheDir, source, preset, ext string, parts sizeParts, body string) {
+	t.Helper()
+
+	dir := filepath.Join(cacheDir, strings.TrimSuffix(source, filepath.Ext(source)))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create cache directory: %v", err)
+	}
+	spec := service.newTransformSpec(preset, ext, parts)
+	path := filepath.Join(dir, spec.key()+ext)
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatalf("Failed to write cached image: %v", err)
+	}
+
+	state, err := readSourceState(filepath.Join(imageDir, source), true)
+	if err != nil {
+		t.Fatalf("Failed to read source state: %v", err)
+	}
+	entry := cacheEntry{
+		Key:           spec.key(),
+		Source:        filepath.ToSlash(source),
+		SourceModTime: state.ModTime,
+		SourceSize:    state.Size,
+		SourceHash:    state.Hash,
+		Spec:          spec,
+		Created:       time.Now().UTC(),
+	}
+	if err = writeSidecar(path, entry); err != nil {
+		t.Fatalf("Failed to write sidecar: %v", err)
+	}
+}
+
+// TestService_Serve_CacheHeaders verifies derivatives get the preset or default Cache-Control and a strong ETag.
+func TestService_Serve_CacheHeaders(t *testing.T) {
+	testDir := t.TempDir()
+	cacheDir := t.TempDir()
+	createEmptyFile(t, filepath.Join(testDir, "test.jpg"))
+
+	presets := map[string]utils.ImagePreset{
+		"thumbnail": {Width: 100, Fit: "contain"},
+		"hero":      {Width: 1200, Fit: "contain", CacheControl: "public, max-age=60"},
+	}
+	service := &Service{
+		Config:    &config.Image{Directory: testDir, Presets: presets, CacheDir: cacheDir, Formats: []string{"jpg"}},
+		HTTPCache: &config.HTTPCache{ETag: true, Images: "public, max-age=31536000, immutable"},
+	}
+	for name := range presets {
+		_, parts, _ := parseSize(name, "", presets)
+		writeCachedImage(t, service, testDir, cacheDir, "test.jpg", name, ".jpg", parts, name)
+	}
+
+	tests := []struct {
+		preset           string
+		wantCacheControl string
+	}{
+		{preset: "thumbnail", wantCacheControl: "public, max-age=31536000, immutable"},
+		{preset: "hero", wantCacheControl: "public, max-age=60"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.preset, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			service.Serve(rec, httptest.NewRequest(http.MethodGet, "/img/"+tt.preset+"/test.jpg", nil))
+
+			if got := rec.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCacheControl)
+			}
+			etag := rec.Header().Get("ETag")
+			if etag == "" {
+				t.Fatalf("ETag not set")
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/img/"+tt.preset+"/test.jpg", nil)
+			req.Header.Set("If-None-Match", etag)
+			rec = httptest.NewRecorder()
+			service.Serve(rec, req)
+			if rec.Code != http.StatusNotModified {
+				t.Errorf("Serve() with matching ETag = %d, want %d", rec.Code, http.StatusNotModified)
+			}
+		})
+	}
+}
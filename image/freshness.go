@@ -0,0 +1,154 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"assetgoblin/utils"
+)
+
+// Source check modes deciding when a cached derivative is outdated.
+const (
+	SourceCheckOff   = "off"
+	SourceCheckMtime = "mtime"
+	SourceCheckHash  = "hash"
+)
+
+// maxSourceChecks bounds the number of derivatives whose last successful source check is remembered.
+const maxSourceChecks = 10000
+
+// sourceChecks remembers when the source of each derivative was last found unchanged.
+type sourceChecks struct {
+	mu sync.Mutex
+	at map[string]time.Time
+}
+
+// recent reports whether the source of the derivative at path was checked within interval.
+func (c *sourceChecks) recent(path string, interval time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	checked, ok := c.at[path]
+	return ok && time.Since(checked) < interval
+}
+
+// store records a successful source check of the derivative at path. If the limit is reached,
+// checks older than interval are dropped first, and all checks if none of them are.
+func (c *sourceChecks) store(path string, interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.at == nil {
+		c.at = map[string]time.Time{}
+	}
+	if _, ok := c.at[path]; !ok && len(c.at) >= maxSourceChecks {
+		for p, checked := range c.at {
+			if time.Since(checked) >= interval {
+				delete(c.at, p)
+			}
+		}
+		if len(c.at) >= maxSourceChecks {
+			clear(c.at)
+		}
+	}
+	c.at[path] = time.Now()
+}
+
+// forget drops the source check of the derivative at path.
+func (c *sourceChecks) forget(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.at, path)
+}
+
+// sourceState describes the version of a source image a derivative was produced from.
+type sourceState struct {
+	ModTime time.Time
+	Size    int64
+	Hash    string
+}
+
+// readSourceState returns the modification time and size of the source at path,
+// and its content hash if withHash is set.
+func readSourceState(path string, withHash bool) (sourceState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return sourceState{}, fmt.Errorf("unable to stat source image: %w", err)
+	}
+
+	state := sourceState{ModTime: info.ModTime().UTC(), Size: info.Size()}
+	if withHash {
+		if state.Hash, err = hashFile(path); err != nil {
+			return sourceState{}, err
+		}
+	}
+	return state, nil
+}
+
+// hashFile returns the hex-encoded SHA-256 hash of the file content at path.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to open file: %w", err)
+	}
+	defer utils.CloseFile(file)
+
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("unable to hash file: %w", err)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// isFresh reports whether the derivative at path was produced from the current version of the source.
+// The source is compared by modification time and size; in hash mode, a changed modification time or size
+// is confirmed by comparing content hashes, and the sidecar is updated if the content is unchanged.
+// Within the configured check interval after a successful check, the derivative is assumed to be fresh.
+func (s *Service) isFresh(path, source string) bool {
+	mode := s.Config.SourceCheck
+	if mode == SourceCheckOff {
+		return true
+	}
+
+	interval := s.Config.SourceCheckInterval
+	if interval > 0 {
+		if s.sourceChecks.recent(path, interval) {
+			return true
+		}
+	}
+
+	entry, err := readSidecar(path)
+	if err != nil {
+		return false
+	}
+	state, err := readSourceState(source, false)
+	if err != nil {
+		return false
+	}
+
+	if !state.ModTime.Equal(entry.SourceModTime) || state.Size != entry.SourceSize {
+		if mode != SourceCheckHash || entry.SourceHash == "" {
+			return false
+		}
+		hash, err := hashFile(source)
+		if err != nil || hash != entry.SourceHash {
+			return false
+		}
+		entry.SourceModTime, entry.SourceSize = state.ModTime, state.Size
+		if err = writeSidecar(path, entry); err != nil {
+			slog.Warn("Failed to update cache sidecar", "error", err)
+		}
+	}
+
+	if interval > 0 {
+		s.sourceChecks.store(path, interval)
+	}
+	return true
+}
@@ -0,0 +1,171 @@
+package image
+
+import (
+	"assetgoblin/config"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestService_IsFresh verifies derivatives are outdated once their source changes.
+func TestService_IsFresh(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		interval time.Duration
+		change   func(t *testing.T, source string)
+		want     bool
+	}{
+		{name: "unchanged source", mode: SourceCheckMtime, change: func(*testing.T, string) {}, want: true},
+		{name: "modified content", mode: SourceCheckMtime, change: rewriteFile("changed"), want: false},
+		{name: "touched source", mode: SourceCheckMtime, change: touchFile, want: false},
+		{name: "touched source with same hash", mode: SourceCheckHash, change: touchFile, want: true},
+		{name: "modified content with hash", mode: SourceCheckHash, change: rewriteFile("changed"), want: false},
+		{name: "checks disabled", mode: SourceCheckOff, change: rewriteFile("changed"), want: true},
+		{name: "within check interval", mode: SourceCheckMtime, interval: time.Hour, change: rewriteFile("changed"), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			imageDir := t.TempDir()
+			cacheDir := t.TempDir()
+			source := filepath.Join(imageDir, "test.jpg")
+			if err := os.WriteFile(source, []byte("original"), 0644); err != nil {
+				t.Fatalf("Failed to write source: %v", err)
+			}
+
+			service := &Service{Config: &config.Image{SourceCheck: tt.mode, SourceCheckInterval: tt.interval}}
+			writeCachedImage(t, service, imageDir, cacheDir, "test.jpg", "", ".jpg", sizeParts{}, "cached")
+			path := filepath.Join(cacheDir, "test", service.newTransformSpec("", ".jpg", sizeParts{}).key()+".jpg")
+
+			if !service.isFresh(path, source) {
+				t.Fatalf("isFresh() = false before change, want true")
+			}
+			tt.change(t, source)
+			if got := service.isFresh(path, source); got != tt.want {
+				t.Errorf("isFresh() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestService_IsFresh_MissingSidecar verifies derivatives without a sidecar are regenerated.
+func TestService_IsFresh_MissingSidecar(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "test.jpg")
+	createEmptyFile(t, source)
+	path := filepath.Join(dir, "cached.jpg")
+	createEmptyFile(t, path)
+
+	service := &Service{Config: &config.Image{SourceCheck: SourceCheckMtime}}
+	if service.isFresh(path, source) {
+		t.Errorf("isFresh() = true, want false")
+	}
+}
+
+// TestSourceChecks_Store verifies the remembered source checks stay bounded.
+func TestSourceChecks_Store(t *testing.T) {
+	var checks sourceChecks
+	for i := range maxSourceChecks {
+		checks.store(strconv.Itoa(i), time.Hour)
+	}
+	if !checks.recent("0", time.Hour) {
+		t.Fatalf("recent() = false for a stored check, want true")
+	}
+
+	checks.store("new", time.Hour)
+	if len(checks.at) > maxSourceChecks {
+		t.Errorf("len(checks) = %d, want at most %d", len(checks.at), maxSourceChecks)
+	}
+	if !checks.recent("new", time.Hour) {
+		t.Errorf("recent() = false for the latest check, want true")
+	}
+
+	checks.forget("new")
+	if checks.recent("new", time.Hour) {
+		t.Errorf("recent() = true after forget, want false")
+	}
+}
+
+// TestService_EnsureDerivative_Regenerate verifies an outdated derivative is replaced by renaming
+// a converted temporary file, so it is never overwritten in place.
+func TestService_EnsureDerivative_Regenerate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	imageDir := t.TempDir()
+	cacheDir := t.TempDir()
+	source := filepath.Join(imageDir, "test.jpg")
+	if err := os.WriteFile(source, []byte("original"), 0644); err != nil {
+		t.Fatalf("Failed to write source: %v", err)
+	}
+
+	service := &Service{Config: &config.Image{SourceCheck: SourceCheckMtime}}
+	writeCachedImage(t, service, imageDir, cacheDir, "test.jpg", "", ".jpg", sizeParts{}, "old")
+	spec := service.newTransformSpec("", ".jpg", sizeParts{})
+	path := filepath.Join(cacheDir, "test", spec.key()+".jpg")
+	rewriteFile("changed")(t, source)
+
+	// The fake converter records its output path and the derivative content seen while converting.
+	binDir := t.TempDir()
+	seen := filepath.Join(binDir, "seen")
+	script := fmt.Sprintf("#!/bin/sh\nprintf '%%s\\n' \"$3\" > %q\ncat %q >> %q\nprintf new > \"$3\"\n", seen, path, seen)
+	if err := os.WriteFile(filepath.Join(binDir, "vips"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake converter: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	d := derivative{source: source, path: path, spec: spec}
+	backend, err := service.ensureDerivative(context.Background(), imageDir, d)
+	if err != nil {
+		t.Fatalf("ensureDerivative() error = %v", err)
+	}
+	if backend != BackendVips {
+		t.Errorf("ensureDerivative() backend = %q, want %q", backend, BackendVips)
+	}
+
+	data, err := os.ReadFile(seen)
+	if err != nil {
+		t.Fatalf("Failed to read converter log: %v", err)
+	}
+	output, during, _ := strings.Cut(string(data), "\n")
+	if output == path || filepath.Dir(output) != filepath.Dir(path) {
+		t.Errorf("converter output = %q, want a temporary file next to %q", output, path)
+	}
+	if during != "old" {
+		t.Errorf("derivative during conversion = %q, want %q", during, "old")
+	}
+	if got, _ := os.ReadFile(path); string(got) != "new" {
+		t.Errorf("derivative = %q, want %q", got, "new")
+	}
+	if _, err = os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("temporary file still exists: %v", err)
+	}
+	if !service.isFresh(path, source) {
+		t.Errorf("isFresh() = false after regeneration, want true")
+	}
+}
+
+// rewriteFile returns a change replacing the file content and moving its modification time forward.
+func rewriteFile(content string) func(t *testing.T, path string) {
+	return func(t *testing.T, path string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to rewrite file: %v", err)
+		}
+		touchFile(t, path)
+	}
+}
+
+// touchFile moves the modification time of the file forward without changing its content.
+func touchFile(t *testing.T, path string) {
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Failed to touch file: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Reasons for removing a cache file during garbage collection.
+const (
+	GCReasonMissingSource   = "missing source"
+	GCReasonUnknownPreset   = "unknown preset"
+	GCReasonOutdatedSpec    = "outdated spec"
+	GCReasonIntermediate    = "intermediate"
+	GCReasonOrphanedSidecar = "orphaned sidecar"
+	GCReasonLegacyName      = "legacy name"
+)
+
+// cacheFileName matches derivatives and sidecars: the cache key followed by the extension.
+// Intermediates produced during conversion carry a suffix after the key, e.g. "<key>_tmp..webp".
+// Before cache keys were hashed, derivatives were named after the size or preset and their transforms,
+// e.g. "300x200_cover_r90.webp", and their intermediates after the derivative, e.g. "small_bc..webp".
+var (
+	cacheFileName              = regexp.MustCompile(`^[0-9a-f]{32}\.[^.]+$`)
+	intermediateFileName       = regexp.MustCompile(`^[0-9a-f]{32}_`)
+	legacyIntermediateFileName = regexp.MustCompile(`_(tmp\.|bc\.|e)\.[^.]+$`)
+)
+
+// GCEntry is a cache file removed by garbage collection, relative to the cache directory.
+type GCEntry struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// GCResult reports the cache files removed by garbage collection.
+type GCResult struct {
+	Removed []GCEntry `json:"removed"`
+	Count   int       `json:"count"`
+	Bytes   int64     `json:"bytes"`
+}
+
+// CollectGarbage removes cache files that can no longer be served: derivatives whose source image
+// was deleted, derivatives of presets that are no longer configured, derivatives produced under a different
+// cache schema or cache version, derivatives named before cache keys were hashed, sidecars without a derivative,
+// and intermediates left over by interrupted conversions that are older than the configured minimum age.
+// Directories left empty are removed.
+// With dryRun set, the files are only reported. Nothing is removed if the image or public directory
+// is the cache directory or inside it.
+func (s *Service) CollectGarbage(dryRun bool) (GCResult, error) {
+	result := GCResult{Removed: []GCEntry{}}
+
+	wd, _ := os.Getwd()
+	imageDir := ensureAbsolute(s.Config.Directory, wd)
+	cacheDir := ensureAbsolute(s.Config.CacheDir, wd)
+
+	// Files of a source directory within the cache directory could be taken for legacy derivatives.
+	for _, dir := range []string{s.Config.Directory, s.PublicDir} {
+		if dir != "" && isWithin(cacheDir, ensureAbsolute(dir, wd)) {
+			return result, fmt.Errorf("unable to collect garbage: source directory %s is inside the cache directory %s", dir, cacheDir)
+		}
+	}
+
+	dirs := map[string]bool{}
+	err := filepath.WalkDir(cacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			// The sidecar of a derivative removed before it was visited.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		reason := s.gcReason(imageDir, cacheDir, path, info)
+		if reason == "" {
+			return nil
+		}
+
+		if !dryRun {
+			if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("unable to remove cache file: %w", err)
+			}
+			if filepath.Ext(path) != sidecarExt && cacheFileName.MatchString(d.Name()) {
+				if err = os.Remove(sidecarPath(path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return fmt.Errorf("unable to remove cache sidecar: %w", err)
+				}
+			}
+			s.sourceChecks.forget(path)
+			dirs[filepath.Dir(path)] = true
+		}
+
+		rel, _ := filepath.Rel(cacheDir, path)
+		result.Removed = append(result.Removed, GCEntry{Path: filepath.ToSlash(rel), Reason: reason})
+		result.Count++
+		result.Bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("unable to collect garbage: %w", err)
+	}
+
+	for dir := range dirs {
+		removeEmptyDirs(dir, cacheDir)
+	}
+
+	return result, nil
+}
+
+// gcReason returns why the cache file at path should be removed, or an empty string to keep it.
+// Files that are neither derivatives, sidecars nor intermediates, current or legacy, are kept.
+func (s *Service) gcReason(imageDir, cacheDir, path string, info fs.FileInfo) string {
+	name := info.Name()
+
+	if intermediateFileName.MatchString(name) || legacyIntermediateFileName.MatchString(name) {
+		if time.Since(info.ModTime()) < s.Config.GC.MinAge {
+			return ""
+		}
+		return GCReasonIntermediate
+	}
+	if !cacheFileName.MatchString(name) {
+		// Derivatives with legacy names are never looked up again.
+		if !strings.HasPrefix(name, ".") && slices.Contains(s.Config.Formats, strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))) {
+			return GCReasonLegacyName
+		}
+		return ""
+	}
+
+	if filepath.Ext(name) == sidecarExt {
+		entry, err := readSidecar(path)
+		if err != nil {
+			return GCReasonOrphanedSidecar
+		}
+		if _, err = os.Stat(strings.TrimSuffix(path, sidecarExt) + "." + entry.Spec.Format); err != nil {
+			return GCReasonOrphanedSidecar
+		}
+		return ""
+	}
+
+	entry, err := readSidecar(path)
+	if err != nil {
+		// Without a sidecar, the location in the cache mirrors the source path without extension.
+		relDir, _ := filepath.Rel(cacheDir, filepath.Dir(path))
+		if _, found := s.findImage(filepath.Join(imageDir, relDir)); !found {
+			return GCReasonMissingSource
+		}
+		return ""
+	}
+
+	if _, err = os.Stat(filepath.Join(imageDir, filepath.FromSlash(entry.Source))); err != nil {
+		return GCReasonMissingSource
+	}
+	if entry.Spec.Version != cacheSchemaVersion || entry.Spec.Namespace != s.Config.CacheVersion {
+		return GCReasonOutdatedSpec
+	}
+	if entry.Spec.Preset != "" {
+		if _, ok := s.Config.Presets[entry.Spec.Preset]; !ok {
+			return GCReasonUnknownPreset
+		}
+	}
+	return ""
+}
+
+// isWithin reports whether path is dir or inside it.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
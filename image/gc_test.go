@@ -0,0 +1,181 @@
+package image
+
+import (
+	"assetgoblin/config"
+	"assetgoblin/utils"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestService_CollectGarbage verifies only cache files that can no longer be served are removed.
+func TestService_CollectGarbage(t *testing.T) {
+	imageDir := t.TempDir()
+	cacheDir := t.TempDir()
+	for _, source := range []string{"kept.jpg", "deleted.jpg", "legacy.jpg"} {
+		createEmptyFile(t, filepath.Join(imageDir, source))
+	}
+
+	service := &Service{Config: &config.Image{
+		Directory: imageDir,
+		CacheDir:  cacheDir,
+		Formats:   []string{"jpg"},
+		GC:        config.ImageGC{MinAge: time.Hour},
+		Presets: map[string]utils.ImagePreset{
+			"small":   {Width: 100, Fit: "contain"},
+			"removed": {Width: 200, Fit: "contain"},
+		},
+	}}
+	kept := cacheFile(t, service, imageDir, cacheDir, "kept.jpg", "small", ".webp")
+	direct := cacheFile(t, service, imageDir, cacheDir, "kept.jpg", "", ".avif")
+	removedPreset := cacheFile(t, service, imageDir, cacheDir, "kept.jpg", "removed", ".avif")
+	deletedSource := cacheFile(t, service, imageDir, cacheDir, "deleted.jpg", "small", ".webp")
+	outdated := cacheFile(t, (&Service{Config: &config.Image{CacheVersion: "old"}}), imageDir, cacheDir, "kept.jpg", "small", ".png")
+	legacy := cacheFile(t, service, imageDir, cacheDir, "legacy.jpg", "small", ".webp")
+	legacyDeleted := filepath.Join(cacheDir, "gone", "0123456789abcdef0123456789abcdef.webp")
+	orphanedSidecar := filepath.Join(cacheDir, "kept", "fedcba9876543210fedcba9876543210.json")
+	oldIntermediate := filepath.Join(cacheDir, "kept", "0123456789abcdef0123456789abcdef_tmp..webp")
+	newIntermediate := filepath.Join(cacheDir, "kept", "0123456789abcdef0123456789abcdef_bc..webp")
+	legacyName := filepath.Join(cacheDir, "kept", "300x200_cover_b1.5_r90.jpg")
+	legacyPreset := filepath.Join(cacheDir, "kept", "small.jpg")
+	oldLegacyIntermediate := filepath.Join(cacheDir, "kept", "small_bc..jpg")
+	newLegacyIntermediate := filepath.Join(cacheDir, "kept", "small_tmp..jpg")
+	unrelated := filepath.Join(cacheDir, "README.txt")
+
+	if err := os.MkdirAll(filepath.Dir(legacyDeleted), 0755); err != nil {
+		t.Fatalf("Failed to create cache directory: %v", err)
+	}
+	for _, path := range []string{legacyDeleted, oldIntermediate, newIntermediate, legacyName, legacyPreset, oldLegacyIntermediate, newLegacyIntermediate, unrelated} {
+		createEmptyFile(t, path)
+	}
+	if err := writeSidecar(orphanedSidecar, cacheEntry{Spec: transformSpec{Format: "webp"}}); err != nil {
+		t.Fatalf("Failed to write sidecar: %v", err)
+	}
+	if err := os.Remove(sidecarPath(legacy)); err != nil {
+		t.Fatalf("Failed to remove sidecar: %v", err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	for _, path := range []string{oldIntermediate, oldLegacyIntermediate} {
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("Failed to age intermediate: %v", err)
+		}
+	}
+	if err := os.Remove(filepath.Join(imageDir, "deleted.jpg")); err != nil {
+		t.Fatalf("Failed to delete source: %v", err)
+	}
+	delete(service.Config.Presets, "removed")
+
+	wantReasons := map[string]string{
+		removedPreset:         GCReasonUnknownPreset,
+		deletedSource:         GCReasonMissingSource,
+		outdated:              GCReasonOutdatedSpec,
+		legacyDeleted:         GCReasonMissingSource,
+		orphanedSidecar:       GCReasonOrphanedSidecar,
+		oldIntermediate:       GCReasonIntermediate,
+		legacyName:            GCReasonLegacyName,
+		legacyPreset:          GCReasonLegacyName,
+		oldLegacyIntermediate: GCReasonIntermediate,
+	}
+
+	dryRun, err := service.CollectGarbage(true)
+	if err != nil {
+		t.Fatalf("CollectGarbage(dryRun) error = %v", err)
+	}
+	if dryRun.Count != len(wantReasons) {
+		t.Errorf("CollectGarbage(dryRun) removed %+v, want %d files", dryRun.Removed, len(wantReasons))
+	}
+	if _, err = os.Stat(deletedSource); err != nil {
+		t.Fatalf("CollectGarbage(dryRun) removed files: %v", err)
+	}
+
+	result, err := service.CollectGarbage(false)
+	if err != nil {
+		t.Fatalf("CollectGarbage() error = %v", err)
+	}
+	for _, entry := range result.Removed {
+		path := filepath.Join(cacheDir, filepath.FromSlash(entry.Path))
+		if want := wantReasons[path]; entry.Reason != want {
+			t.Errorf("removed %s for %q, want %q", entry.Path, entry.Reason, want)
+		}
+	}
+	if result.Count != len(wantReasons) {
+		t.Errorf("CollectGarbage() removed %+v, want %d files", result.Removed, len(wantReasons))
+	}
+
+	for _, path := range []string{kept, sidecarPath(kept), direct, legacy, newIntermediate, newLegacyIntermediate, unrelated} {
+		if _, err = os.Stat(path); err != nil {
+			t.Errorf("kept file %s removed: %v", path, err)
+		}
+	}
+	for _, path := range []string{sidecarPath(deletedSource), filepath.Dir(deletedSource), filepath.Dir(legacyDeleted)} {
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", path)
+		}
+	}
+}
+
+// cacheFile stores a derivative with its sidecar and returns its path.
+func cacheFile(t *testing.T, service *Service, imageDir, cacheDir, source, preset, ext string) string {
+	t.Helper()
+
+	parts := sizeParts{}
+	if preset != "" {
+		_, parts, _ = parseSize(preset, "", service.Config.Presets)
+	}
+	writeCachedImage(t, service, imageDir, cacheDir, source, preset, ext, parts, source)
+
+	base := source[:len(source)-len(filepath.Ext(source))]
+	return filepath.Join(cacheDir, base, service.newTransformSpec(preset, ext, parts).key()+ext)
+}
+
+// TestService_CollectGarbage_SourceInCache verifies nothing is removed if a source directory
+// is the cache directory or inside it, while a cache directory inside the image directory is collected.
+func TestService_CollectGarbage_SourceInCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		imageDir  string
+		publicDir string
+		cacheDir  string
+		wantErr   bool
+	}{
+		{name: "same directory", imageDir: "img", cacheDir: "img", wantErr: true},
+		{name: "image directory inside cache", imageDir: "cache/img", cacheDir: "cache", wantErr: true},
+		{name: "public directory inside cache", imageDir: "img", publicDir: "cache/public", cacheDir: "cache", wantErr: true},
+		{name: "cache inside image directory", imageDir: "img", cacheDir: "img/cache"},
+		{name: "sibling with common prefix", imageDir: "cache-img", cacheDir: "cache"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			imageDir := filepath.Join(root, tt.imageDir)
+			cacheDir := filepath.Join(root, tt.cacheDir)
+			if err := os.MkdirAll(filepath.Join(cacheDir, "photo"), 0755); err != nil {
+				t.Fatalf("Failed to create cache directory: %v", err)
+			}
+			if err := os.MkdirAll(imageDir, 0755); err != nil {
+				t.Fatalf("Failed to create image directory: %v", err)
+			}
+			source := filepath.Join(imageDir, "photo.jpg")
+			createEmptyFile(t, source)
+			legacy := filepath.Join(cacheDir, "photo", "small.jpg")
+			createEmptyFile(t, legacy)
+
+			service := &Service{Config: &config.Image{Directory: imageDir, CacheDir: cacheDir, Formats: []string{"jpg"}}}
+			if tt.publicDir != "" {
+				service.PublicDir = filepath.Join(root, tt.publicDir)
+			}
+			_, err := service.CollectGarbage(false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CollectGarbage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, err = os.Stat(source); err != nil {
+				t.Errorf("source image removed: %v", err)
+			}
+			if _, err = os.Stat(legacy); tt.wantErr == os.IsNotExist(err) {
+				t.Errorf("legacy derivative removed = %v, want %v", os.IsNotExist(err), !tt.wantErr)
+			}
+		})
+	}
+}
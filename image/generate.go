@@ -0,0 +1,239 @@
+package image
+
+import (
+	"assetgoblin/tracing"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// derivative describes a cached image produced from a source image.
+type derivative struct {
+	source       string // source is the path of the source image
+	path         string // path is the path of the cached image
+	resizeOption string
+	parts        sizeParts
+	spec         transformSpec
+}
+
+// statusError is an error reported to the client with an HTTP status code.
+// Client errors are reported with their cause; server errors are logged
+// with their cause and reported with the message only.
+type statusError struct {
+	status  int
+	message string
+	err     error
+}
+
+func (e *statusError) Error() string {
+	if e.err == nil {
+		return e.message
+	}
+	return e.message + ": " + e.err.Error()
+}
+
+// writeError reports err to the client with the status of a statusError, or 500 otherwise.
+func writeError(res http.ResponseWriter, err error) {
+	statusErr, ok := errors.AsType[*statusError](err)
+	if !ok {
+		statusErr = &statusError{status: http.StatusInternalServerError, message: "Internal server error", err: err}
+	}
+
+	if statusErr.status >= http.StatusInternalServerError {
+		slog.Error(statusErr.message, "error", statusErr.err)
+		http.Error(res, statusErr.message, statusErr.status)
+		return
+	}
+	http.Error(res, statusErr.Error(), statusErr.status)
+}
+
+// resolveDerivative determines the cached image to serve for a source image in the given format.
+// The preset name is empty for direct sizes. Source dimensions are read when the extract area,
+// the enlarge policy or the fit mode depend on them, after checking the source file size limit.
+// If redirect is set and the enlarge policy redirects the request, the preset or size to redirect
+// to is returned instead; otherwise the capped size is served, e.g. for signed requests whose token
+// would not match the redirect target.
+func (s *Service) resolveDerivative(ctx context.Context, imageDir, cacheDir, source, presetName, ext, resizeOption string, parts sizeParts, redirect bool) (derivative, string, error) {
+	enlarge := EnlargePolicy(s.Config.Enlarge)
+	if presetName != "" {
+		if preset := s.Config.Presets[presetName]; preset.Enlarge != "" {
+			enlarge = EnlargePolicy(preset.Enlarge)
+		}
+	}
+	checkEnlarge := parts.hasSize && enlarge != "" && enlarge != EnlargeAllow
+
+	if parts.extract != nil || checkEnlarge || (parts.hasSize && parts.fit == FitModeOutside) {
+		if err := s.checkSourceBytes(source); err != nil {
+			return derivative{}, "", &statusError{status: http.StatusRequestEntityTooLarge, message: "Source image exceeds limits", err: err}
+		}
+		sourceWidth, sourceHeight, err := s.sourceDimensions(ctx, source)
+		if err != nil {
+			return derivative{}, "", &statusError{status: http.StatusInternalServerError, message: "Error while reading image dimensions", err: err}
+		}
+		parts.sourceSize = [2]int{sourceWidth, sourceHeight}
+	}
+
+	if parts.extract != nil {
+		x, y, w, h, err := parts.extract.Resolve(parts.sourceSize[0], parts.sourceSize[1])
+		if err != nil {
+			return derivative{}, "", &statusError{status: http.StatusBadRequest, message: "Invalid extract", err: err}
+		}
+		parts.extractPx = [4]int{x, y, w, h}
+	}
+
+	if checkEnlarge {
+		if cappedOption, capped := capToSource(&parts); capped {
+			if enlarge == EnlargeRedirect && redirect {
+				if target, ok := s.enlargeRedirectTarget(presetName != "", parts, cappedOption); ok {
+					return derivative{}, target, nil
+				}
+			}
+			resizeOption = cappedOption
+		}
+	}
+
+	sourceBasePath := strings.TrimSuffix(source, filepath.Ext(source))
+	relSourcePath, err := filepath.Rel(imageDir, sourceBasePath)
+	if err != nil {
+		return derivative{}, "", &statusError{status: http.StatusInternalServerError, message: "Error while resolving source path", err: err}
+	}
+
+	spec := s.newTransformSpec(presetName, ext, parts)
+	return derivative{
+		source:       source,
+		path:         filepath.Join(cacheDir, relSourcePath, spec.key()+ext),
+		resizeOption: resizeOption,
+		parts:        parts,
+		spec:         spec,
+	}, "", nil
+}
+
+// Backends converting images.
+const (
+	BackendVips        = "vips"
+	BackendImageMagick = "imagemagick"
+)
+
+// ensureDerivative generates the cached image unless it exists and its source did not change.
+// Returns the backend that generated the image, or an empty string if the cached image is used.
+func (s *Service) ensureDerivative(ctx context.Context, imageDir string, d derivative) (string, error) {
+	_, span := tracing.Start(ctx, "image.cache_lookup")
+	_, err := os.Stat(d.path)
+	fresh := err == nil && s.isFresh(d.path, d.source)
+	span.SetAttribute("image.cache.hit", fresh)
+	span.End()
+
+	if fresh {
+		return "", nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", &statusError{status: http.StatusInternalServerError, message: "Error while reading cache", err: err}
+	}
+	return s.generate(ctx, imageDir, d)
+}
+
+// generate produces the cached image and its sidecar after checking the resource limits.
+// The image is converted with libvips, falling back to ImageMagick, into a temporary file that
+// replaces the cached image once complete. Partial outputs of failed or killed conversions are
+// removed, so they are never served from the cache.
+// Returns the backend that converted the image.
+func (s *Service) generate(ctx context.Context, imageDir string, d derivative) (backend string, err error) {
+	ctx, span := tracing.Start(ctx, "image.transform")
+	defer func() {
+		span.SetAttribute("image.backend", backend)
+		span.SetError(err)
+		span.End()
+	}()
+
+	if !s.beginGeneration() {
+		return "", &statusError{status: http.StatusServiceUnavailable, message: "Service is shutting down"}
+	}
+	defer s.endGeneration()
+
+	parts := d.parts
+
+	if err := s.checkSourceBytes(d.source); err != nil {
+		return "", &statusError{status: http.StatusRequestEntityTooLarge, message: "Source image exceeds limits", err: err}
+	}
+	if parts.sourceSize[0] == 0 && s.needsSourceSize(parts) {
+		sourceWidth, sourceHeight, err := s.sourceDimensions(ctx, d.source)
+		if err != nil {
+			return "", &statusError{status: http.StatusInternalServerError, message: "Error while reading image dimensions", err: err}
+		}
+		parts.sourceSize = [2]int{sourceWidth, sourceHeight}
+	}
+	if err := s.checkSourcePixels(parts); err != nil {
+		return "", &statusError{status: http.StatusRequestEntityTooLarge, message: "Source image exceeds limits", err: err}
+	}
+	if err := s.checkOutputLimits(parts); err != nil {
+		return "", &statusError{status: http.StatusBadRequest, message: "Requested size exceeds limits", err: err}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.path), 0755); err != nil {
+		return "", &statusError{status: http.StatusInternalServerError, message: "Error while creating cache", err: err}
+	}
+
+	ext := filepath.Ext(d.path)
+	format := strings.TrimPrefix(ext, ".")
+
+	// Convert into a temporary file next to the derivative and rename it into place, so concurrent
+	// readers never see a partially written image. The name keeps the extension for the converters
+	// and is collected like an intermediate if the process dies before the rename.
+	key := strings.TrimSuffix(filepath.Base(d.path), ext)
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), key+"_*"+ext)
+	if err != nil {
+		return "", &statusError{status: http.StatusInternalServerError, message: "Error while creating cache", err: err}
+	}
+	output := tmp.Name()
+	_ = tmp.Close()
+	defer removePartial(output)
+
+	if ext != ".avif" || s.Config.AvifThroughVips {
+		cmds := buildVipsCommands(d.source, output, d.resizeOption, parts)
+		start := time.Now()
+		if err := s.runAll(ctx, cmds); err == nil {
+			backend = BackendVips
+			transformDuration.Observe(time.Since(start).Seconds(), backend, format)
+		} else {
+			removePartial(output)
+			if s.isStopping() {
+				return "", &statusError{status: http.StatusServiceUnavailable, message: "Service is shutting down", err: err}
+			}
+			converterFallbacks.Inc()
+		}
+	}
+	if backend == "" {
+		prefix := ""
+		if runtime.GOOS == "windows" {
+			prefix = "magick "
+		}
+		cmd := buildConvertCommand(prefix, d.source, output, d.resizeOption, parts)
+		start := time.Now()
+		if err := s.run(ctx, cmd); err != nil {
+			return "", &statusError{status: http.StatusInternalServerError, message: "Error while converting image", err: err}
+		}
+		backend = BackendImageMagick
+		transformDuration.Observe(time.Since(start).Seconds(), backend, format)
+	}
+	if err := os.Rename(output, d.path); err != nil {
+		return "", &statusError{status: http.StatusInternalServerError, message: "Error while writing cache", err: err}
+	}
+
+	relSource, _ := filepath.Rel(imageDir, d.source)
+	entry := cacheEntry{Key: d.spec.key(), Source: filepath.ToSlash(relSource), Spec: d.spec, Created: time.Now().UTC()}
+	if state, err := readSourceState(d.source, s.Config.SourceCheck == SourceCheckHash); err == nil {
+		entry.SourceModTime, entry.SourceSize, entry.SourceHash = state.ModTime, state.Size, state.Hash
+	}
+	if err := writeSidecar(d.path, entry); err != nil {
+		slog.Warn("Failed to write cache sidecar", "error", err)
+	}
+	s.sourceChecks.forget(d.path)
+
+	return backend, nil
+}
@@ -0,0 +1,58 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// converters lists the commands printing the version of the supported converters.
+var converters = []struct {
+	name string
+	args []string
+}{
+	{name: "vips", args: []string{"--version"}},
+	{name: "convert", args: []string{"-version"}},
+}
+
+// CheckConverters runs libvips and ImageMagick to verify at least one of them is usable.
+// It returns the versions of the usable converters.
+func CheckConverters(ctx context.Context) (string, error) {
+	var versions []string
+	var errs []error
+	for _, converter := range converters {
+		name, args := converter.name, converter.args
+		if name == "convert" && runtime.GOOS == "windows" {
+			name = "magick"
+		}
+
+		out, err := exec.CommandContext(ctx, name, args...).Output()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		version, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+		versions = append(versions, version)
+	}
+
+	if len(versions) == 0 {
+		return "", errors.Join(errs...)
+	}
+	return strings.Join(versions, "; "), nil
+}
+
+// CheckCacheDir verifies the cache directory is writable by creating and removing a temporary file.
+func (s *Service) CheckCacheDir() error {
+	if err := os.MkdirAll(s.Config.CacheDir, 0755); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(s.Config.CacheDir, ".healthcheck-*")
+	if err != nil {
+		return err
+	}
+	_ = file.Close()
+	return os.Remove(file.Name())
+}
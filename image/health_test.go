@@ -0,0 +1,40 @@
+package image
+
+import (
+	"assetgoblin/config"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCheckConverters verifies the check fails when neither libvips nor ImageMagick can be run.
+func TestCheckConverters(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := CheckConverters(context.Background()); err == nil {
+		t.Errorf("CheckConverters() without converters = nil, want error")
+	}
+}
+
+// TestService_CheckCacheDir verifies the cache directory is created and left clean.
+func TestService_CheckCacheDir(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "img")
+	service := &Service{Config: &config.Image{CacheDir: cacheDir}}
+
+	if err := service.CheckCacheDir(); err != nil {
+		t.Fatalf("CheckCacheDir() error = %v", err)
+	}
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to read cache directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("cache directory has %d entries, want none", len(entries))
+	}
+
+	blocked := filepath.Join(t.TempDir(), "file")
+	createEmptyFile(t, blocked)
+	if err = (&Service{Config: &config.Image{CacheDir: blocked}}).CheckCacheDir(); err == nil {
+		t.Errorf("CheckCacheDir() on a file = nil, want error")
+	}
+}
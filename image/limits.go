@@ -0,0 +1,67 @@
+package image
+
+import (
+	"fmt"
+	"math"
+	"os"
+)
+
+// checkOutputLimits verifies that the requested output dimensions are within the configured limits.
+// If the height is automatic and the source size is known, the height is estimated from the aspect ratio.
+func (s *Service) checkOutputLimits(parts sizeParts) error {
+	limits := s.Config.Limits
+
+	width, height := parts.width, parts.height
+	if parts.hasSize && parts.fit == FitModeOutside {
+		width, height = outsideSize(parts)
+	}
+	if height <= 0 {
+		if sourceWidth, sourceHeight := effectiveSourceSize(parts); sourceWidth > 0 && sourceHeight > 0 {
+			height = int(math.Ceil(float64(width) * float64(sourceHeight) / float64(sourceWidth)))
+		}
+	}
+
+	if limits.MaxWidth > 0 && width > limits.MaxWidth {
+		return fmt.Errorf("width %d exceeds the maximum of %d", width, limits.MaxWidth)
+	}
+	if limits.MaxHeight > 0 && height > limits.MaxHeight {
+		return fmt.Errorf("height %d exceeds the maximum of %d", height, limits.MaxHeight)
+	}
+	if limits.MaxPixels > 0 && int64(width)*int64(height) > limits.MaxPixels {
+		return fmt.Errorf("%dx%d exceeds the maximum of %d pixels", width, height, limits.MaxPixels)
+	}
+
+	return nil
+}
+
+// needsSourceSize reports whether the source dimensions are required to enforce the configured limits.
+func (s *Service) needsSourceSize(parts sizeParts) bool {
+	limits := s.Config.Limits
+	return limits.MaxSourcePixels > 0 || (limits.MaxPixels > 0 && parts.height <= 0)
+}
+
+// checkSourceBytes verifies that the source file size is within the configured limit.
+func (s *Service) checkSourceBytes(path string) error {
+	if s.Config.Limits.MaxSourceBytes <= 0 {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("unable to stat source image: %w", err)
+	}
+	if info.Size() > s.Config.Limits.MaxSourceBytes {
+		return fmt.Errorf("source image of %d bytes exceeds the maximum of %d bytes", info.Size(), s.Config.Limits.MaxSourceBytes)
+	}
+
+	return nil
+}
+
+// checkSourcePixels verifies that the decoded source image size is within the configured limit.
+func (s *Service) checkSourcePixels(parts sizeParts) error {
+	limit := s.Config.Limits.MaxSourcePixels
+	if limit > 0 && int64(parts.sourceSize[0])*int64(parts.sourceSize[1]) > limit {
+		return fmt.Errorf("source image of %dx%d exceeds the maximum of %d pixels", parts.sourceSize[0], parts.sourceSize[1], limit)
+	}
+	return nil
+}
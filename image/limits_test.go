@@ -0,0 +1,114 @@
+package image
+
+import (
+	"assetgoblin/config"
+	"assetgoblin/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestService_CheckOutputLimits verifies output width, height and pixel limits.
+func TestService_CheckOutputLimits(t *testing.T) {
+	service := &Service{
+		Config: &config.Image{
+			Limits: config.ImageLimits{MaxWidth: 1000, MaxHeight: 800, MaxPixels: 500000},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		parts   sizeParts
+		wantErr bool
+	}{
+		{name: "within limits", parts: sizeParts{width: 640, height: 480, hasSize: true}},
+		{name: "width too large", parts: sizeParts{width: 1001, height: 10, hasSize: true}, wantErr: true},
+		{name: "height too large", parts: sizeParts{width: 10, height: 801, hasSize: true}, wantErr: true},
+		{name: "too many pixels", parts: sizeParts{width: 1000, height: 600, hasSize: true}, wantErr: true},
+		{name: "width only without source size", parts: sizeParts{width: 900}},
+		{name: "auto height estimated from source", parts: sizeParts{width: 900, sourceSize: [2]int{100, 100}}, wantErr: true},
+		{
+			name:    "outside size is checked",
+			parts:   sizeParts{width: 500, height: 500, fit: FitModeOutside, hasSize: true, sourceSize: [2]int{100, 400}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := service.checkOutputLimits(tt.parts); (err != nil) != tt.wantErr {
+				t.Errorf("checkOutputLimits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestService_Serve_Limits verifies that limit violations are rejected before conversion.
+func TestService_Serve_Limits(t *testing.T) {
+	testDir := t.TempDir()
+	createPNG(t, filepath.Join(testDir, "test.png"), 80, 60)
+	if err := os.WriteFile(filepath.Join(testDir, "garbage.png"), make([]byte, 100), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		limits     config.ImageLimits
+		urlPath    string
+		wantStatus int
+	}{
+		{
+			name:       "oversized direct size",
+			limits:     config.ImageLimits{MaxWidth: 4096, MaxHeight: 4096},
+			urlPath:    "/img/99999x99999/test.png",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "oversized width only",
+			limits:     config.ImageLimits{MaxWidth: 4096},
+			urlPath:    "/img/99999/test.png",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "source file too large",
+			limits:     config.ImageLimits{MaxSourceBytes: 10},
+			urlPath:    "/img/thumbnail/test.png",
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "source file too large before reading dimensions",
+			limits:     config.ImageLimits{MaxSourceBytes: 10},
+			urlPath:    "/img/thumbnail/garbage.png?extract=0,0,10,10",
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "source has too many pixels",
+			limits:     config.ImageLimits{MaxSourcePixels: 1000},
+			urlPath:    "/img/thumbnail/test.png",
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &Service{
+				Config: &config.Image{
+					Directory: testDir,
+					Presets:   map[string]utils.ImagePreset{"thumbnail": {Width: 100, Fit: "contain"}},
+					CacheDir:  t.TempDir(),
+					Formats:   []string{"png"},
+					Limits:    tt.limits,
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.urlPath, nil)
+			rec := httptest.NewRecorder()
+			service.Serve(rec, req)
+			if status := rec.Result().StatusCode; status != tt.wantStatus {
+				t.Errorf("Serve() = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package image
+
+import (
+	"assetgoblin/metrics"
+	"io/fs"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	cacheRequests = metrics.NewCounterVec("assetgoblin_image_cache_requests_total",
+		"Image requests served from the cache (hit) or converted first (miss).", "result")
+	transformDuration = metrics.NewHistogramVec("assetgoblin_image_transform_duration_seconds",
+		"Duration of successful image conversions by backend and output format.", metrics.DurationBuckets, "backend", "format")
+	converterFallbacks = metrics.NewCounterVec("assetgoblin_image_converter_fallbacks_total",
+		"Conversions retried with ImageMagick after libvips failed.")
+)
+
+// cacheSizeInterval is how long the measured cache size is reused.
+const cacheSizeInterval = time.Minute
+
+// cacheSize memoizes the size of the cache directory, as walking it on every scrape is expensive.
+type cacheSize struct {
+	mu         sync.Mutex
+	bytes      int64
+	measuredAt time.Time
+}
+
+// CacheBytes returns the total size of the files in the cache directory, measured at most once a minute.
+func (s *Service) CacheBytes() int64 {
+	s.cacheSize.mu.Lock()
+	defer s.cacheSize.mu.Unlock()
+
+	if !s.cacheSize.measuredAt.IsZero() && time.Since(s.cacheSize.measuredAt) < cacheSizeInterval {
+		return s.cacheSize.bytes
+	}
+
+	var total int64
+	_ = filepath.WalkDir(s.Config.CacheDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+
+	s.cacheSize.bytes = total
+	s.cacheSize.measuredAt = time.Now()
+	return total
+}
@@ -0,0 +1,68 @@
+package image
+
+import (
+	"assetgoblin/config"
+	"assetgoblin/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestService_Serve_CacheMetrics verifies cache hits are counted when serving cached derivatives.
+func TestService_Serve_CacheMetrics(t *testing.T) {
+	testDir := t.TempDir()
+	cacheDir := t.TempDir()
+	createEmptyFile(t, filepath.Join(testDir, "test.jpg"))
+
+	service := &Service{
+		Config: &config.Image{
+			Directory: testDir,
+			Presets:   map[string]utils.ImagePreset{"thumbnail": {Width: 100, Fit: "contain"}},
+			CacheDir:  cacheDir,
+			Formats:   []string{"jpg"},
+		},
+	}
+	_, parts, _ := parseSize("thumbnail", "", service.Config.Presets)
+	writeCachedImage(t, service, testDir, cacheDir, "test.jpg", "thumbnail", ".jpg", parts, "cached")
+
+	hits, misses := cacheRequests.Value("hit"), cacheRequests.Value("miss")
+	rec := httptest.NewRecorder()
+	service.Serve(rec, httptest.NewRequest(http.MethodGet, "/img/thumbnail/test.jpg", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Serve() = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := cacheRequests.Value("hit") - hits; got != 1 {
+		t.Errorf("cache hits = %v, want 1", got)
+	}
+	if got := cacheRequests.Value("miss") - misses; got != 0 {
+		t.Errorf("cache misses = %v, want 0", got)
+	}
+}
+
+// TestService_CacheBytes verifies the cache size is summed and reused until it expires.
+func TestService_CacheBytes(t *testing.T) {
+	cacheDir := t.TempDir()
+	service := &Service{Config: &config.Image{CacheDir: cacheDir}}
+
+	if err := os.MkdirAll(filepath.Join(cacheDir, "photos"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for name, size := range map[string]int{"a.jpg": 100, "photos/b.jpg": 23} {
+		if err := os.WriteFile(filepath.Join(cacheDir, name), make([]byte, size), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	if got := service.CacheBytes(); got != 123 {
+		t.Errorf("CacheBytes() = %d, want 123", got)
+	}
+	if err := os.WriteFile(filepath.Join(cacheDir, "c.jpg"), make([]byte, 10), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if got := service.CacheBytes(); got != 123 {
+		t.Errorf("CacheBytes() within interval = %d, want cached 123", got)
+	}
+}
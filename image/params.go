@@ -0,0 +1,170 @@
+package image
+
+import (
+	"assetgoblin/utils"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// knownParams lists the query parameters understood by Serve.
+// The token and expires parameters are consumed by the signkey middleware.
+var knownParams = map[string]bool{
+	"fit":        true,
+	"bg":         true,
+	"rotate":     true,
+	"flip":       true,
+	"crop":       true,
+	"extract":    true,
+	"brightness": true,
+	"contrast":   true,
+	"gamma":      true,
+	"filter":     true,
+	"token":      true,
+	"expires":    true,
+}
+
+// paramError describes an invalid query parameter.
+type paramError struct {
+	param string
+	err   error
+}
+
+// Error returns the offending parameter name along with the validation error.
+func (e *paramError) Error() string {
+	return fmt.Sprintf("parameter %q: %s", e.param, e.err)
+}
+
+// applyQuery applies the transform query parameters to parts.
+// In strict mode unknown parameters and invalid values are reported as a *paramError;
+// otherwise invalid values are ignored. Invalid extract rectangles are always reported.
+func applyQuery(query url.Values, parts *sizeParts, strict bool) error {
+	if strict {
+		names := make([]string, 0, len(query))
+		for name := range query {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			if !knownParams[name] {
+				return &paramError{param: name, err: fmt.Errorf("unknown parameter")}
+			}
+		}
+	}
+
+	// invalid reports err for param in strict mode and swallows it otherwise.
+	invalid := func(param string, err error) error {
+		if strict {
+			return &paramError{param: param, err: err}
+		}
+		return nil
+	}
+
+	if fit := query.Get("fit"); fit != "" {
+		if err := utils.ValidateFit(fit); err != nil {
+			if err = invalid("fit", err); err != nil {
+				return err
+			}
+		}
+	}
+
+	if value := query.Get("bg"); value != "" {
+		if color, err := utils.ParseColor(value); err != nil {
+			if err = invalid("bg", err); err != nil {
+				return err
+			}
+		} else {
+			parts.background = color
+		}
+	}
+
+	if value := query.Get("rotate"); value != "" {
+		rotate, err := strconv.Atoi(value)
+		if err == nil {
+			err = utils.ValidateRotate(rotate)
+		}
+		if err != nil {
+			if err = invalid("rotate", fmt.Errorf("must be 0, 90, 180, or 270")); err != nil {
+				return err
+			}
+		} else {
+			parts.rotate = rotate
+		}
+	}
+
+	if value := query.Get("flip"); value != "" {
+		if err := utils.ValidateFlip(value); err != nil {
+			if err = invalid("flip", err); err != nil {
+				return err
+			}
+		} else {
+			parts.flip = value
+		}
+	}
+
+	if value := query.Get("crop"); value != "" {
+		if err := utils.ValidateCrop(value); err != nil {
+			if err = invalid("crop", err); err != nil {
+				return err
+			}
+		} else {
+			parts.crop = value
+		}
+	}
+
+	if value := query.Get("extract"); value != "" {
+		area, err := utils.ParseExtract(value)
+		if err != nil {
+			return &paramError{param: "extract", err: err}
+		}
+		parts.extract = &area
+	}
+
+	adjustments := []struct {
+		param    string
+		validate func(float64) error
+		target   *float64
+	}{
+		{param: "brightness", validate: utils.ValidateBrightness, target: &parts.brightness},
+		{param: "contrast", validate: utils.ValidateContrast, target: &parts.contrast},
+		{param: "gamma", validate: utils.ValidateGamma, target: &parts.gamma},
+	}
+	for _, adjustment := range adjustments {
+		value := query.Get(adjustment.param)
+		if value == "" {
+			continue
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			err = fmt.Errorf("must be a number")
+		} else {
+			err = adjustment.validate(number)
+		}
+		if err != nil {
+			if err = invalid(adjustment.param, err); err != nil {
+				return err
+			}
+			continue
+		}
+		*adjustment.target = number
+	}
+
+	if value := query.Get("filter"); value != "" {
+		filters := slices.Clone(parts.filters)
+		for _, f := range strings.Split(value, ",") {
+			f = strings.TrimSpace(f)
+			if err := utils.ValidateFilter(f); err != nil {
+				if err = invalid("filter", err); err != nil {
+					return err
+				}
+				continue
+			}
+			filters = append(filters, f)
+		}
+		parts.filters = filters
+	}
+
+	return nil
+}
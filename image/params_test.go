@@ -0,0 +1,118 @@
+package image
+
+import (
+	"assetgoblin/config"
+	"assetgoblin/utils"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestApplyQuery verifies query parameter handling in lenient and strict mode.
+func TestApplyQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		strict    bool
+		wantParam string
+		check     func(t *testing.T, parts sizeParts)
+	}{
+		{
+			name:  "valid values",
+			query: "rotate=90&flip=vertical&crop=top&brightness=10&contrast=-5&gamma=2&filter=grayscale,%20blur&bg=000",
+			check: func(t *testing.T, parts sizeParts) {
+				if parts.rotate != 90 || parts.flip != "vertical" || parts.crop != "top" || parts.background != "000000" {
+					t.Errorf("applyQuery() parts = %+v", parts)
+				}
+				if parts.brightness != 10 || parts.contrast != -5 || parts.gamma != 2 || len(parts.filters) != 2 {
+					t.Errorf("applyQuery() adjustments = %+v", parts)
+				}
+			},
+		},
+		{
+			name:  "invalid values are ignored when lenient",
+			query: "rotate=45&flip=diagonal&gamma=20&filter=blurr,sepia&unknown=1",
+			check: func(t *testing.T, parts sizeParts) {
+				if parts.rotate != 0 || parts.flip != "" || parts.gamma != 0 || len(parts.filters) != 1 {
+					t.Errorf("applyQuery() parts = %+v", parts)
+				}
+			},
+		},
+		{name: "unknown parameter when strict", query: "rotate=90&widht=100", strict: true, wantParam: "widht"},
+		{name: "invalid rotate when strict", query: "rotate=45", strict: true, wantParam: "rotate"},
+		{name: "invalid fit when strict", query: "fit=stretch", strict: true, wantParam: "fit"},
+		{name: "invalid brightness when strict", query: "brightness=bright", strict: true, wantParam: "brightness"},
+		{name: "invalid filter when strict", query: "filter=grayscale,blurr", strict: true, wantParam: "filter"},
+		{name: "invalid extract when lenient", query: "extract=1,2", wantParam: "extract"},
+		{name: "token is known when strict", query: "token=abc&rotate=180", strict: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery() error = %v", err)
+			}
+
+			var parts sizeParts
+			err = applyQuery(query, &parts, tt.strict)
+
+			var pErr *paramError
+			if tt.wantParam == "" {
+				if err != nil {
+					t.Fatalf("applyQuery() error = %v, want nil", err)
+				}
+			} else if !errors.As(err, &pErr) || pErr.param != tt.wantParam {
+				t.Fatalf("applyQuery() error = %v, want error for parameter %q", err, tt.wantParam)
+			}
+			if tt.check != nil {
+				tt.check(t, parts)
+			}
+		})
+	}
+}
+
+// TestApplyQuery_DoesNotModifyPresetFilters verifies query filters do not alias preset filters.
+func TestApplyQuery_DoesNotModifyPresetFilters(t *testing.T) {
+	presetFilters := make([]string, 1, 4)
+	presetFilters[0] = "grayscale"
+	parts := sizeParts{filters: presetFilters}
+
+	if err := applyQuery(url.Values{"filter": {"blur"}}, &parts, false); err != nil {
+		t.Fatalf("applyQuery() error = %v", err)
+	}
+	if len(parts.filters) != 2 || presetFilters[:2][1] == "blur" {
+		t.Errorf("applyQuery() modified preset filters: %v", presetFilters[:2])
+	}
+}
+
+// TestService_Serve_StrictParams verifies strict mode responses name the offending parameter.
+func TestService_Serve_StrictParams(t *testing.T) {
+	testDir := t.TempDir()
+	createEmptyFile(t, filepath.Join(testDir, "test.jpg"))
+
+	service := &Service{
+		Config: &config.Image{
+			Directory:    testDir,
+			Presets:      map[string]utils.ImagePreset{"thumbnail": {Width: 100, Fit: "contain"}},
+			CacheDir:     t.TempDir(),
+			Formats:      []string{"jpg"},
+			StrictParams: true,
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/img/thumbnail/test.jpg?contrast=150", nil)
+	rec := httptest.NewRecorder()
+	service.Serve(rec, req)
+
+	if status := rec.Result().StatusCode; status != http.StatusBadRequest {
+		t.Fatalf("Serve() = %d, want %d", status, http.StatusBadRequest)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `"contrast"`) {
+		t.Errorf("body = %q, want it to name the contrast parameter", body)
+	}
+}
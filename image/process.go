@@ -0,0 +1,148 @@
+package image
+
+import (
+	"assetgoblin/tracing"
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// errShuttingDown is returned for conversions started after Shutdown.
+var errShuttingDown = errors.New("service is shutting down")
+
+// processes tracks the running conversions and their child processes.
+type processes struct {
+	mu          sync.Mutex
+	stopping    bool
+	running     map[*exec.Cmd]struct{}
+	generations sync.WaitGroup
+}
+
+// beginGeneration registers a generation in flight. Returns false once Shutdown was called.
+func (s *Service) beginGeneration() bool {
+	s.procs.mu.Lock()
+	defer s.procs.mu.Unlock()
+
+	if s.procs.stopping {
+		return false
+	}
+	s.procs.generations.Add(1)
+	return true
+}
+
+// endGeneration marks a generation registered with beginGeneration as finished.
+func (s *Service) endGeneration() {
+	s.procs.generations.Done()
+}
+
+// isStopping reports whether Shutdown was called.
+func (s *Service) isStopping() bool {
+	s.procs.mu.Lock()
+	defer s.procs.mu.Unlock()
+	return s.procs.stopping
+}
+
+// run starts cmd and waits for it to exit, so it can be killed by Shutdown in the meantime.
+// The command is traced in a span of ctx and receives the trace context in TRACEPARENT.
+func (s *Service) run(ctx context.Context, cmd *exec.Cmd) (err error) {
+	_, span := tracing.Start(ctx, "exec "+filepath.Base(cmd.Args[0]))
+	defer func() {
+		if cmd.ProcessState != nil {
+			span.SetAttribute("process.exit.code", cmd.ProcessState.ExitCode())
+		}
+		span.SetError(err)
+		span.End()
+	}()
+	if span != nil {
+		// The arguments contain absolute source and cache paths, so only their number is recorded.
+		span.SetAttribute("process.executable.name", filepath.Base(cmd.Args[0]))
+		span.SetAttribute("process.args_count", len(cmd.Args))
+		cmd.Env = append(os.Environ(), "TRACEPARENT="+span.Traceparent())
+	}
+
+	s.procs.mu.Lock()
+	if s.procs.stopping {
+		s.procs.mu.Unlock()
+		return errShuttingDown
+	}
+	if err := cmd.Start(); err != nil {
+		s.procs.mu.Unlock()
+		return err
+	}
+	if s.procs.running == nil {
+		s.procs.running = map[*exec.Cmd]struct{}{}
+	}
+	s.procs.running[cmd] = struct{}{}
+	s.procs.mu.Unlock()
+
+	err = cmd.Wait()
+
+	s.procs.mu.Lock()
+	delete(s.procs.running, cmd)
+	s.procs.mu.Unlock()
+
+	return err
+}
+
+// output runs cmd with run and returns its standard output without surrounding whitespace.
+func (s *Service) output(ctx context.Context, cmd *exec.Cmd) (string, error) {
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	err := s.run(ctx, cmd)
+	return strings.TrimSpace(out.String()), err
+}
+
+// runAll runs the commands one after another with run and stops at the first failure.
+func (s *Service) runAll(ctx context.Context, cmds []*exec.Cmd) error {
+	for _, cmd := range cmds {
+		if err := s.run(ctx, cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Shutdown stops new conversions, kills the running child processes and waits
+// until the interrupted generations have cleaned up their partial outputs.
+func (s *Service) Shutdown() {
+	s.procs.mu.Lock()
+	s.procs.stopping = true
+	for cmd := range s.procs.running {
+		if err := cmd.Process.Kill(); err != nil {
+			slog.Warn("Failed to kill conversion", "error", err)
+		}
+	}
+	killed := len(s.procs.running)
+	s.procs.mu.Unlock()
+
+	if killed > 0 {
+		slog.Info("Killed running conversions", "count", killed)
+	}
+	s.procs.generations.Wait()
+}
+
+// removePartial removes the possibly partial derivative at path along with its sidecar
+// and the intermediates of its conversion.
+func removePartial(path string) {
+	dir := filepath.Dir(path)
+	key := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == filepath.Base(path) || name == key+sidecarExt || strings.HasPrefix(name, key+"_") {
+			if err = os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+				slog.Warn("Failed to remove partial output", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package image
+
+import (
+	"assetgoblin/config"
+	"assetgoblin/tracing"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestService_Shutdown verifies Shutdown kills running conversions and rejects new ones.
+func TestService_Shutdown(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sleep")
+	}
+	service := &Service{Config: &config.Image{}}
+
+	if !service.beginGeneration() {
+		t.Fatalf("beginGeneration() = false before Shutdown")
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer service.endGeneration()
+		done <- service.run(context.Background(), exec.Command("sleep", "10"))
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		service.procs.mu.Lock()
+		running := len(service.procs.running)
+		service.procs.mu.Unlock()
+		if running == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("conversion did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		service.Shutdown()
+		close(stopped)
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("run() = nil for killed process, want error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Shutdown() did not kill the running process")
+	}
+	<-stopped
+
+	if service.beginGeneration() {
+		t.Errorf("beginGeneration() = true after Shutdown")
+	}
+	if err := service.run(context.Background(), exec.Command("true")); !errors.Is(err, errShuttingDown) {
+		t.Errorf("run() after Shutdown = %v, want %v", err, errShuttingDown)
+	}
+}
+
+// TestRemovePartial verifies the derivative, its sidecar and its intermediates are removed.
+func TestRemovePartial(t *testing.T) {
+	dir := t.TempDir()
+	key := "0123456789abcdef0123456789abcdef"
+	other := "fedcba9876543210fedcba9876543210"
+	removed := []string{key + ".jpg", key + ".json", key + "_resized.png"}
+	kept := []string{other + ".jpg", other + ".json", other + "_resized.png"}
+	for _, name := range append(removed, kept...) {
+		createEmptyFile(t, filepath.Join(dir, name))
+	}
+
+	removePartial(filepath.Join(dir, key+".jpg"))
+
+	for _, name := range removed {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s not removed", name)
+		}
+	}
+	for _, name := range kept {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s removed: %v", name, err)
+		}
+	}
+}
+
+// TestService_Run_Traceparent verifies traced commands receive the trace context in TRACEPARENT.
+func TestService_Run_Traceparent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	collector := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer collector.Close()
+
+	tracer := tracing.NewTracer(&config.Tracing{Endpoint: collector.URL, SampleRate: 1, ServiceName: "test"})
+	defer tracer.Shutdown(context.Background())
+
+	service := &Service{Config: &config.Image{}}
+	var out bytes.Buffer
+	handler := tracer.Middleware(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		cmd := exec.Command("sh", "-c", "echo $TRACEPARENT")
+		cmd.Stdout = &out
+		if err := service.run(req.Context(), cmd); err != nil {
+			t.Errorf("run() error = %v", err)
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/img/a.jpg", nil))
+
+	if got := strings.TrimSpace(out.String()); !regexp.MustCompile(`^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`).MatchString(got) {
+		t.Errorf("TRACEPARENT = %q, want a sampled traceparent", got)
+	}
+}
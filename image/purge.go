@@ -0,0 +1,178 @@
+package image
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PurgeFilter selects the derivatives to purge.
+// Set fields are combined, so a derivative is purged only if it matches all of them.
+type PurgeFilter struct {
+	Source string // Source is a source image path relative to the image directory, with or without extension
+	Preset string // Preset is the name of the preset the derivative was produced for
+	Prefix string // Prefix matches the source image path itself and the source images in the directory it names
+}
+
+// PurgeResult reports the derivatives removed by a purge.
+type PurgeResult struct {
+	Removed []string `json:"removed"`
+	Count   int      `json:"count"`
+	Bytes   int64    `json:"bytes"`
+}
+
+// isEmpty reports whether no field of the filter is set.
+func (f PurgeFilter) isEmpty() bool {
+	return f.Source == "" && f.Preset == "" && f.Prefix == ""
+}
+
+// matches reports whether a derivative of source produced for preset is selected by the filter.
+// Derivatives without a sidecar only know their source path without extension and have no known preset.
+func (f PurgeFilter) matches(source, preset string, hasSidecar bool) bool {
+	if f.Preset != "" && (!hasSidecar || preset != f.Preset) {
+		return false
+	}
+	if f.Prefix != "" && source != f.Prefix && !strings.HasPrefix(source, f.Prefix+"/") {
+		return false
+	}
+	if f.Source != "" && source != f.Source {
+		// Compare without extensions if either side has none.
+		if filepath.Ext(source) != "" && filepath.Ext(f.Source) != "" {
+			return false
+		}
+		if strings.TrimSuffix(source, filepath.Ext(source)) != strings.TrimSuffix(f.Source, filepath.Ext(f.Source)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Purge removes the derivatives selected by the filter from the cache, along with their sidecars,
+// and removes directories left empty. Derivatives are matched by their sidecar; derivatives without
+// one are matched by their location in the cache, which mirrors the source path.
+func (s *Service) Purge(filter PurgeFilter) (PurgeResult, error) {
+	result := PurgeResult{Removed: []string{}}
+
+	filter.Source = strings.TrimPrefix(filepath.ToSlash(filter.Source), "/")
+	filter.Prefix = strings.Trim(filepath.ToSlash(filter.Prefix), "/")
+	if filter.isEmpty() {
+		return result, fmt.Errorf("at least one of source, preset or prefix is required")
+	}
+
+	wd, _ := os.Getwd()
+	cacheDir := ensureAbsolute(s.Config.CacheDir, wd)
+
+	// The derivatives of a single source are all stored in the directory mirroring its path.
+	root := cacheDir
+	if filter.Source != "" {
+		root = filepath.Join(cacheDir, filepath.FromSlash(strings.TrimSuffix(filter.Source, filepath.Ext(filter.Source))))
+		if !isWithin(cacheDir, root) || root == cacheDir {
+			// Sources outside the image directory have no derivatives.
+			return result, nil
+		}
+	}
+
+	dirs := map[string]bool{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) == sidecarExt {
+			return nil
+		}
+
+		relDir, err := filepath.Rel(cacheDir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		source, preset := filepath.ToSlash(relDir), ""
+		entry, sidecarErr := readSidecar(path)
+		if sidecarErr == nil {
+			source, preset = entry.Source, entry.Spec.Preset
+		}
+		if !filter.matches(source, preset, sidecarErr == nil) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err = os.Remove(path); err != nil {
+			return fmt.Errorf("unable to remove derivative: %w", err)
+		}
+		if err = os.Remove(sidecarPath(path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("Failed to remove cache sidecar", "error", err)
+		}
+		s.sourceChecks.forget(path)
+
+		rel, _ := filepath.Rel(cacheDir, path)
+		result.Removed = append(result.Removed, filepath.ToSlash(rel))
+		result.Count++
+		result.Bytes += info.Size()
+		dirs[filepath.Dir(path)] = true
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("unable to purge cache: %w", err)
+	}
+
+	for dir := range dirs {
+		removeEmptyDirs(dir, cacheDir)
+	}
+
+	return result, nil
+}
+
+// removeEmptyDirs removes dir and its parents up to, but excluding, root as long as they are empty.
+func removeEmptyDirs(dir, root string) {
+	for dir != root && strings.HasPrefix(dir, root) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// ServePurge handles administrative purge requests.
+// The filter is read from the source, preset and prefix query or form parameters,
+// and the removed derivatives are reported as JSON. Only POST and DELETE requests are accepted.
+func (s *Service) ServePurge(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost && req.Method != http.MethodDelete {
+		res.Header().Set("Allow", "POST, DELETE")
+		http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter := PurgeFilter{
+		Source: req.FormValue("source"),
+		Preset: req.FormValue("preset"),
+		Prefix: req.FormValue("prefix"),
+	}
+	if filter.isEmpty() {
+		http.Error(res, "At least one of source, preset or prefix is required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.Purge(filter)
+	if err != nil {
+		slog.Error("Error while purging cache", "error", err)
+		http.Error(res, "Error while purging cache", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Cache purged", "source", filter.Source, "preset", filter.Preset, "prefix", filter.Prefix, "count", result.Count)
+
+	res.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(res).Encode(result); err != nil {
+		slog.Warn("Failed to write purge result", "error", err)
+	}
+}
@@ -0,0 +1,147 @@
+package image
+
+import (
+	"assetgoblin/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestService_Purge verifies derivatives are selected by source, preset and prefix.
+func TestService_Purge(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter PurgeFilter
+		want   []string
+	}{
+		{name: "source with extension", filter: PurgeFilter{Source: "photos/cat.jpg"}, want: []string{"photos/cat:large", "photos/cat:legacy", "photos/cat:thumbnail"}},
+		{name: "source without extension", filter: PurgeFilter{Source: "/photos/dog"}, want: []string{"photos/dog:thumbnail"}},
+		{name: "preset", filter: PurgeFilter{Preset: "thumbnail"}, want: []string{"photos/cat:thumbnail", "photos/dog:thumbnail", "photoshoot/cat:thumbnail"}},
+		{name: "prefix", filter: PurgeFilter{Prefix: "photos/"}, want: []string{"photos/cat:large", "photos/cat:legacy", "photos/cat:thumbnail", "photos/dog:thumbnail"}},
+		{name: "prefix without slash", filter: PurgeFilter{Prefix: "photos"}, want: []string{"photos/cat:large", "photos/cat:legacy", "photos/cat:thumbnail", "photos/dog:thumbnail"}},
+		{name: "prefix naming a source", filter: PurgeFilter{Prefix: "photos/cat.jpg"}, want: []string{"photos/cat:large", "photos/cat:thumbnail"}},
+		{name: "prefix and preset", filter: PurgeFilter{Prefix: "photos/", Preset: "large"}, want: []string{"photos/cat:large"}},
+		{name: "no match", filter: PurgeFilter{Source: "missing.jpg"}, want: []string{}},
+		{name: "source outside image directory", filter: PurgeFilter{Source: "../photos/cat.jpg"}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, paths := createPurgeCache(t)
+
+			result, err := service.Purge(tt.filter)
+			if err != nil {
+				t.Fatalf("Purge() error = %v", err)
+			}
+			if result.Count != len(tt.want) || len(result.Removed) != len(tt.want) {
+				t.Fatalf("Purge() removed %v, want %v", result.Removed, tt.want)
+			}
+
+			for name, path := range paths {
+				_, err := os.Stat(path)
+				if removed := os.IsNotExist(err); removed != slices.Contains(tt.want, name) {
+					t.Errorf("derivative %s removed = %v, want %v", name, removed, !removed)
+				}
+			}
+			if slices.Contains(tt.want, "photos/dog:thumbnail") {
+				if _, err = os.Stat(filepath.Join(service.Config.CacheDir, "photos", "dog")); !os.IsNotExist(err) {
+					t.Errorf("empty cache directory not removed")
+				}
+			}
+		})
+	}
+}
+
+// TestService_Purge_EmptyFilter verifies purging everything by accident is rejected.
+func TestService_Purge_EmptyFilter(t *testing.T) {
+	service, _ := createPurgeCache(t)
+	if _, err := service.Purge(PurgeFilter{}); err == nil {
+		t.Errorf("Purge() error = nil, want error")
+	}
+}
+
+// TestService_ServePurge verifies the purge endpoint validates requests and reports removed derivatives.
+func TestService_ServePurge(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		wantStatus int
+		wantCount  int
+	}{
+		{name: "purge by preset", method: http.MethodPost, query: "?preset=thumbnail", wantStatus: http.StatusOK, wantCount: 3},
+		{name: "missing filter", method: http.MethodPost, wantStatus: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodGet, query: "?preset=thumbnail", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _ := createPurgeCache(t)
+
+			req := httptest.NewRequest(tt.method, "/admin/cache/purge"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			service.ServePurge(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("ServePurge() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var result PurgeResult
+			if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+				t.Fatalf("Failed to decode purge result: %v", err)
+			}
+			if result.Count != tt.wantCount || result.Bytes == 0 {
+				t.Errorf("ServePurge() result = %+v, want %d removed", result, tt.wantCount)
+			}
+		})
+	}
+}
+
+// createPurgeCache populates a cache with derivatives of several sources and presets,
+// including one without a sidecar, and returns the service and derivative paths by "source:preset".
+func createPurgeCache(t *testing.T) (*Service, map[string]string) {
+	t.Helper()
+
+	imageDir := t.TempDir()
+	cacheDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(imageDir, "photos"), 0755); err != nil {
+		t.Fatalf("Failed to create image directory: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(imageDir, "photoshoot"), 0755); err != nil {
+		t.Fatalf("Failed to create image directory: %v", err)
+	}
+	for _, source := range []string{"photos/cat.jpg", "photos/dog.png", "photoshoot/cat.jpg", "banner.jpg"} {
+		createEmptyFile(t, filepath.Join(imageDir, source))
+	}
+
+	service := &Service{Config: &config.Image{Directory: imageDir, CacheDir: cacheDir}}
+	paths := map[string]string{}
+	for _, d := range []struct{ source, preset string }{
+		{"photos/cat.jpg", "thumbnail"},
+		{"photos/cat.jpg", "large"},
+		{"photos/dog.png", "thumbnail"},
+		{"photoshoot/cat.jpg", "thumbnail"},
+		{"banner.jpg", ""},
+	} {
+		parts := sizeParts{width: len(d.preset) * 10, hasSize: d.preset != ""}
+		writeCachedImage(t, service, imageDir, cacheDir, d.source, d.preset, ".webp", parts, d.source)
+		key := service.newTransformSpec(d.preset, ".webp", parts).key()
+		base := d.source[:len(d.source)-len(filepath.Ext(d.source))]
+		paths[base+":"+d.preset] = filepath.Join(cacheDir, base, key+".webp")
+	}
+
+	legacy := filepath.Join(cacheDir, "photos", "cat", "legacy.webp")
+	if err := os.WriteFile(legacy, []byte("legacy"), 0644); err != nil {
+		t.Fatalf("Failed to write legacy derivative: %v", err)
+	}
+	paths["photos/cat:legacy"] = legacy
+
+	return service, paths
+}
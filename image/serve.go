@@ -3,11 +3,16 @@
 package image
 
 import (
+	"assetgoblin/metrics"
+	"assetgoblin/middleware"
+	"assetgoblin/tracing"
+	"assetgoblin/utils"
+	"io"
 	"log/slog"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
-	"runtime"
 	"slices"
 	"strconv"
 	"strings"
@@ -18,19 +23,33 @@ type FitMode string
 const (
 	FitModeContain FitMode = "contain"
 	FitModeCover   FitMode = "cover"
+	FitModeFill    FitMode = "fill"
+	FitModeInside  FitMode = "inside"
+	FitModeOutside FitMode = "outside"
+	FitModePad     FitMode = "pad"
 )
 
+// EnlargePolicy controls whether images are upscaled beyond their source dimensions.
+type EnlargePolicy string
+
+const (
+	EnlargeAllow    EnlargePolicy = "allow"
+	EnlargeNever    EnlargePolicy = "never"
+	EnlargeRedirect EnlargePolicy = "redirect"
+)
+
+// defaultBackground is the color used to pad images when no background is set.
+const defaultBackground = "ffffff"
+
 // Serve handles HTTP requests for images, processing them according to the requested preset.
 // It extracts the preset name and image path from the URL, finds the image file,
 // resizes it according to the preset with optional transforms (rotate, flip, brightness, contrast, gamma, filters),
-// caches the result, and serves it to the client.
-// If the image is already cached, it serves the cached version directly.
+// caches the result under a hash of its transform spec, and serves it to the client.
+// If the image is already cached and the source is unchanged, it serves the cached version directly.
 // The URL format should be: /[base_path]/[preset_name]/[image_path]
 // Alternatively, direct dimensions can be used: /[base_path]/[width]/[image_path] or /[base_path]/[width]x[height]/[image_path]
-// Query parameters: fit, rotate, flip, crop, brightness, contrast, gamma, filter
+// Query parameters: fit, bg, rotate, flip, crop, extract, brightness, contrast, gamma, filter
 func (s *Service) Serve(res http.ResponseWriter, req *http.Request) {
-	slog.Info("Request received", "method", req.Method, "path", req.URL.Path, "remote", req.RemoteAddr, "user-agent", req.UserAgent())
-
 	wd, _ := os.Getwd()
 
 	imageDir := ensureAbsolute(s.Config.Directory, wd)
@@ -54,9 +73,6 @@ func (s *Service) Serve(res http.ResponseWriter, req *http.Request) {
 	}
 
 	queryFit := req.URL.Query().Get("fit")
-	queryRotate := req.URL.Query().Get("rotate")
-	queryFlip := req.URL.Query().Get("flip")
-	queryCrop := req.URL.Query().Get("crop")
 
 	resizeOption, sizeParts, isPreset := parseSize(presetOrSizes, queryFit, s.Config.Presets)
 	if resizeOption == "" && !isPreset {
@@ -64,146 +80,157 @@ func (s *Service) Serve(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if queryRotate != "" {
-		r, err := strconv.Atoi(queryRotate)
-		if err == nil && (r == 0 || r == 90 || r == 180 || r == 270) {
-			sizeParts.rotate = r
+	if !isPreset {
+		allowed, ok := s.allowedSize(req, sizeParts)
+		if !ok || (allowed != presetOrSizes && s.Config.AllowedSizes.Mode != "snap" && s.Config.AllowedSizes.Mode != "redirect") {
+			http.Error(res, "Size not allowed: "+presetOrSizes, http.StatusBadRequest)
+			return
 		}
-	}
-	if queryFlip != "" {
-		if queryFlip == "horizontal" || queryFlip == "vertical" || queryFlip == "both" {
-			sizeParts.flip = queryFlip
+		if allowed != presetOrSizes {
+			if s.Config.AllowedSizes.Mode == "redirect" && !middleware.IsVerified(req) {
+				redirectToSize(res, req, splitPath, allowed)
+				return
+			}
+			presetOrSizes = allowed
+			resizeOption, sizeParts, _ = parseSize(presetOrSizes, queryFit, s.Config.Presets)
 		}
 	}
-	if queryCrop != "" {
-		validCrops := map[string]bool{
-			"top-left":     true,
-			"top":          true,
-			"top-right":    true,
-			"left":         true,
-			"center":       true,
-			"right":        true,
-			"bottom-left":  true,
-			"bottom":       true,
-			"bottom-right": true,
-		}
-		if validCrops[queryCrop] {
-			sizeParts.crop = queryCrop
-		}
+
+	if err := applyQuery(req.URL.Query(), &sizeParts, s.Config.StrictParams); err != nil {
+		http.Error(res, "Invalid "+err.Error(), http.StatusBadRequest)
+		return
 	}
-	queryBrightness := req.URL.Query().Get("brightness")
-	queryContrast := req.URL.Query().Get("contrast")
-	queryGamma := req.URL.Query().Get("gamma")
-	filterStr := req.URL.Query().Get("filter")
-
-	if b, err := strconv.ParseFloat(queryBrightness, 64); err == nil && b >= -100 && b <= 100 {
-		sizeParts.brightness = b
-	}
-	if c, err := strconv.ParseFloat(queryContrast, 64); err == nil && c >= -100 && c <= 100 {
-		sizeParts.contrast = c
-	}
-	if g, err := strconv.ParseFloat(queryGamma, 64); err == nil && g >= 0.1 && g <= 10.0 {
-		sizeParts.gamma = g
-	}
-
-	if filterStr != "" {
-		queryFilters := strings.Split(filterStr, ",")
-		validFilters := map[string]bool{
-			"grayscale": true,
-			"sepia":     true,
-			"blur":      true,
-			"sharpen":   true,
-			"negate":    true,
-			"invert":    true,
-			"normalize": true,
-			"equalize":  true,
-			"contrast":  true,
-			"edge":      true,
-			"emboss":    true,
-			"charcoal":  true,
-			"solarize":  true,
-			"paint":     true,
-			"oil":       true,
-			"sketch":    true,
-			"vignette":  true,
-		}
-		for _, f := range queryFilters {
-			f = strings.TrimSpace(f)
-			if validFilters[f] {
-				sizeParts.filters = append(sizeParts.filters, f)
-			}
-		}
+
+	if err := s.checkOutputLimits(sizeParts); err != nil {
+		http.Error(res, "Requested size exceeds limits: "+err.Error(), http.StatusBadRequest)
+		return
 	}
 
+	_, findSpan := tracing.Start(req.Context(), "image.find_source")
 	foundPath, found := s.findImage(strings.TrimSuffix(requestedPath, requestedExt))
+	isFallback := false
 	if !found {
-		http.NotFound(res, req)
-		return
+		if foundPath, found = s.findFallback(imageDir, path); !found {
+			findSpan.SetAttribute("image.found", false)
+			findSpan.End()
+			http.NotFound(res, req)
+			return
+		}
+		isFallback = true
 	}
+	findSpan.SetAttribute("image.found", true)
+	findSpan.SetAttribute("image.fallback", isFallback)
+	findSpan.End()
 
-	sourceBasePath := strings.TrimSuffix(foundPath, filepath.Ext(foundPath))
-	relSourcePath, err := filepath.Rel(imageDir, sourceBasePath)
+	presetName := ""
+	if isPreset {
+		presetName = presetOrSizes
+		metrics.SetPreset(req, presetName)
+	} else {
+		metrics.SetPreset(req, "direct")
+	}
+
+	d, target, err := s.resolveDerivative(req.Context(), imageDir, cacheDir, foundPath, presetName, requestedExt, resizeOption, sizeParts, !middleware.IsVerified(req))
 	if err != nil {
-		slog.Error("Error while resolving source path", "error", err)
-		http.Error(res, "Error while resolving source path", http.StatusInternalServerError)
+		writeError(res, err)
+		return
+	}
+	if target != "" {
+		redirectToSize(res, req, splitPath, target)
 		return
 	}
 
-	cacheKey := presetOrSizes
-	if sizeParts.hasSize {
-		cacheKey = presetOrSizes + "_" + string(sizeParts.fit)
+	backend, err := s.ensureDerivative(req.Context(), imageDir, d)
+	if err != nil {
+		writeError(res, err)
+		return
 	}
-	if sizeParts.rotate > 0 {
-		cacheKey += "_r" + strconv.Itoa(sizeParts.rotate)
+	if backend != "" {
+		cacheRequests.Inc("miss")
+		middleware.SetCacheResult(req, "miss", backend)
+	} else {
+		cacheRequests.Inc("hit")
+		middleware.SetCacheResult(req, "hit", "")
 	}
-	if sizeParts.flip != "" {
-		cacheKey += "_f" + sizeParts.flip
+
+	_, serveSpan := tracing.Start(req.Context(), "image.serve_file")
+	defer serveSpan.End()
+
+	if isFallback {
+		s.serveFallback(res, req, d.path)
+		return
 	}
-	if sizeParts.brightness != 0 {
-		cacheKey += "_b" + strconv.FormatFloat(sizeParts.brightness, 'f', -1, 64)
+
+	s.setCacheHeaders(res, presetName, d.path)
+	http.ServeFile(res, req, d.path)
+}
+
+// setCacheHeaders sets the Cache-Control header of the preset, or of derivatives in general,
+// and a strong ETag for the cached image at path.
+func (s *Service) setCacheHeaders(res http.ResponseWriter, presetName, path string) {
+	if s.HTTPCache == nil {
+		return
 	}
-	if sizeParts.contrast != 0 {
-		cacheKey += "_c" + strconv.FormatFloat(sizeParts.contrast, 'f', -1, 64)
+
+	cacheControl := s.HTTPCache.Images
+	if preset := s.Config.Presets[presetName]; presetName != "" && preset.CacheControl != "" {
+		cacheControl = preset.CacheControl
 	}
-	if sizeParts.gamma > 0 && sizeParts.gamma != 1.0 {
-		cacheKey += "_g" + strconv.FormatFloat(sizeParts.gamma, 'f', -1, 64)
+	if cacheControl != "" {
+		res.Header().Set("Cache-Control", cacheControl)
 	}
-	if len(sizeParts.filters) > 0 {
-		cacheKey += "_" + strings.Join(sizeParts.filters, ",")
+
+	if s.HTTPCache.ETag {
+		info, err := os.Stat(path)
+		if err == nil {
+			var etag string
+			if etag, err = utils.FileETag(path, info); err == nil {
+				res.Header().Set("ETag", etag)
+			}
+		}
+		if err != nil {
+			slog.Warn("Failed to compute ETag", "error", err)
+		}
 	}
-	if sizeParts.crop != "" {
-		cacheKey += "_crop" + sizeParts.crop
+}
+
+// redirectToSize redirects the client to the same image and query with a different preset or size.
+func redirectToSize(res http.ResponseWriter, req *http.Request, splitPath []string, presetOrSize string) {
+	redirectPath := slices.Clone(splitPath)
+	redirectPath[2] = presetOrSize
+
+	target := strings.Join(redirectPath, "/")
+	if req.URL.RawQuery != "" {
+		target += "?" + req.URL.RawQuery
 	}
+	http.Redirect(res, req, target, http.StatusFound)
+}
 
-	finalPath := filepath.Join(cacheDir, relSourcePath, cacheKey+requestedExt)
+// serveFallback serves a rendered fallback image with the configured status code.
+// The response is marked with the X-Image-Fallback header and only cached briefly,
+// so the real image is picked up soon after it appears.
+func (s *Service) serveFallback(res http.ResponseWriter, req *http.Request, path string) {
+	res.Header().Set("X-Image-Fallback", "true")
+	res.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(s.Config.Fallback.MaxAge.Seconds())))
 
-	if _, err := os.Stat(finalPath); os.IsNotExist(err) {
-		if err = os.MkdirAll(filepath.Dir(finalPath), 0755); err != nil {
-			slog.Error("Error while creating cache", "error", err)
-			http.Error(res, "Error while creating cache", http.StatusInternalServerError)
-			return
-		}
+	if s.Config.Fallback.Status != http.StatusNotFound {
+		http.ServeFile(res, req, path)
+		return
+	}
 
-		vipsEncoded := false
-		if requestedExt != ".avif" || s.Config.AvifThroughVips {
-			cmd := buildVipsCommand(foundPath, finalPath, resizeOption, sizeParts)
-			if err = cmd.Run(); err == nil {
-				vipsEncoded = true
-			}
-		}
-		if !vipsEncoded {
-			prefix := ""
-			if runtime.GOOS == "windows" {
-				prefix = "magick "
-			}
-			cmd := buildConvertCommand(prefix, foundPath, finalPath, resizeOption, sizeParts)
-			if err = cmd.Run(); err != nil {
-				slog.Error("Error while converting image", "error", err)
-				http.Error(res, "Error while converting image", http.StatusInternalServerError)
-				return
-			}
-		}
+	file, err := os.Open(path)
+	if err != nil {
+		slog.Error("Error while opening fallback image", "error", err)
+		http.Error(res, "Error while opening fallback image", http.StatusInternalServerError)
+		return
 	}
+	defer utils.CloseFile(file)
 
-	http.ServeFile(res, req, finalPath)
+	res.Header().Set("Content-Type", mime.TypeByExtension(filepath.Ext(path)))
+	res.WriteHeader(http.StatusNotFound)
+	if req.Method != http.MethodHead {
+		if _, err = io.Copy(res, file); err != nil {
+			slog.Warn("Failed to write fallback image", "error", err)
+		}
+	}
 }
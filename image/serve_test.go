@@ -2,13 +2,16 @@ package image
 
 import (
 	"assetgoblin/config"
+	"assetgoblin/middleware"
 	"assetgoblin/utils"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestService_Serve_PathValidation validates Serve behavior for malformed paths and inputs.
@@ -192,6 +195,274 @@ func TestService_Serve_AbsoluteCacheDir(t *testing.T) {
 	}
 }
 
+// TestService_Serve_Fallback verifies missing sources are replaced by the configured fallback.
+func TestService_Serve_Fallback(t *testing.T) {
+	testDir := t.TempDir()
+	cacheDir := t.TempDir()
+
+	createEmptyFile(t, filepath.Join(testDir, "placeholder.jpg"))
+	if err := os.MkdirAll(filepath.Join(testDir, "products"), 0755); err != nil {
+		t.Fatalf("Failed to create test directory: %v", err)
+	}
+	createEmptyFile(t, filepath.Join(testDir, "products", "placeholder.jpg"))
+
+	presets := map[string]utils.ImagePreset{"thumbnail": {Width: 100, Fit: "contain"}}
+	_, parts, _ := parseSize("thumbnail", "", presets)
+	for _, rel := range []string{"placeholder", filepath.Join("products", "placeholder")} {
+		writeCachedImage(t, &Service{Config: &config.Image{}}, testDir, cacheDir, rel+".jpg", "thumbnail", ".jpg", parts, rel)
+	}
+
+	tests := []struct {
+		name       string
+		status     int
+		urlPath    string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "default fallback with 404",
+			status:     http.StatusNotFound,
+			urlPath:    "/img/thumbnail/missing.jpg",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "placeholder",
+		},
+		{
+			name:       "prefix fallback with 200",
+			status:     http.StatusOK,
+			urlPath:    "/img/thumbnail/products/shoes/missing.jpg",
+			wantStatus: http.StatusOK,
+			wantBody:   filepath.Join("products", "placeholder"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &Service{
+				Config: &config.Image{
+					Directory: testDir,
+					Presets:   presets,
+					CacheDir:  cacheDir,
+					Formats:   []string{"jpg"},
+					Fallback: config.ImageFallback{
+						Source:   "placeholder.jpg",
+						Prefixes: []config.FallbackRule{{Prefix: "products/", Source: "products/placeholder.jpg"}},
+						Status:   tt.status,
+						MaxAge:   time.Minute,
+					},
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.urlPath, nil)
+			rec := httptest.NewRecorder()
+			service.Serve(rec, req)
+
+			if status := rec.Result().StatusCode; status != tt.wantStatus {
+				t.Fatalf("Serve() = %d, want %d", status, tt.wantStatus)
+			}
+			if got := rec.Header().Get("X-Image-Fallback"); got != "true" {
+				t.Errorf("X-Image-Fallback = %q, want %q", got, "true")
+			}
+			if got := rec.Header().Get("Cache-Control"); got != "public, max-age=60" {
+				t.Errorf("Cache-Control = %q, want %q", got, "public, max-age=60")
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+// TestService_Serve_Extract verifies extract validation against the source dimensions.
+func TestService_Serve_Extract(t *testing.T) {
+	testDir := t.TempDir()
+	cacheDir := t.TempDir()
+	createPNG(t, filepath.Join(testDir, "test.png"), 80, 60)
+
+	service := &Service{
+		Config: &config.Image{
+			Directory: testDir,
+			Presets:   map[string]utils.ImagePreset{"thumbnail": {Width: 100, Fit: "contain"}},
+			CacheDir:  cacheDir,
+			Formats:   []string{"png"},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{name: "malformed extract", query: "extract=1,2,3", wantStatus: http.StatusBadRequest},
+		{name: "extract outside source", query: "extract=50,0,40,10", wantStatus: http.StatusBadRequest},
+		{name: "extract percentages outside source", query: "extract=50%25,0,60%25,10%25", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/img/thumbnail/test.png?"+tt.query, nil)
+			rec := httptest.NewRecorder()
+			service.Serve(rec, req)
+			if status := rec.Result().StatusCode; status != tt.wantStatus {
+				t.Errorf("Serve() = %d, want %d", status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// TestService_Serve_EnlargeRedirect verifies upscaling requests are redirected to non-upscaled variants.
+func TestService_Serve_EnlargeRedirect(t *testing.T) {
+	testDir := t.TempDir()
+	createPNG(t, filepath.Join(testDir, "test.png"), 80, 60)
+
+	service := &Service{
+		Config: &config.Image{
+			Directory: testDir,
+			Presets: map[string]utils.ImagePreset{
+				"lg":    {Width: 4000, Fit: "contain"},
+				"sm":    {Width: 50, Fit: "contain"},
+				"xs":    {Width: 20, Fit: "contain"},
+				"cover": {Width: 60, Height: 60, Fit: "cover"},
+			},
+			CacheDir: t.TempDir(),
+			Formats:  []string{"png"},
+			Enlarge:  string(EnlargeRedirect),
+		},
+	}
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantLocation string
+	}{
+		{name: "direct size", urlPath: "/img/4000x3000/test.png", wantLocation: "/img/80x60/test.png"},
+		{name: "direct width", urlPath: "/img/4000/test.png", wantLocation: "/img/80/test.png"},
+		{name: "direct size keeps query", urlPath: "/img/160x90/test.png?fit=cover", wantLocation: "/img/80x45/test.png?fit=cover"},
+		{name: "preset", urlPath: "/img/lg/test.png", wantLocation: "/img/sm/test.png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.urlPath, nil)
+			rec := httptest.NewRecorder()
+			service.Serve(rec, req)
+			if status := rec.Result().StatusCode; status != http.StatusFound {
+				t.Fatalf("Serve() = %d, want %d", status, http.StatusFound)
+			}
+			if location := rec.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
+			}
+		})
+	}
+}
+
+// TestService_Serve_EnlargeRedirect_AllowedSizes verifies capped direct sizes redirect to the largest
+// allowed size within the source, and are served in place if no allowed size fits.
+func TestService_Serve_EnlargeRedirect_AllowedSizes(t *testing.T) {
+	testDir := t.TempDir()
+	cacheDir := t.TempDir()
+	createPNG(t, filepath.Join(testDir, "test.png"), 80, 60)
+	_, capped, _ := parseSize("300x100", "fill", nil)
+	capped.sourceSize = [2]int{80, 60}
+	capToSource(&capped)
+	writeCachedImage(t, &Service{Config: &config.Image{}}, testDir, cacheDir, "test.png", "", ".png", capped, "capped")
+
+	service := &Service{
+		Config: &config.Image{
+			Directory:    testDir,
+			CacheDir:     cacheDir,
+			Formats:      []string{"png"},
+			Enlarge:      string(EnlargeRedirect),
+			AllowedSizes: config.AllowedSizes{Sizes: []string{"50", "100", "40x30", "200x150", "300x100"}},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		urlPath      string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{name: "width", urlPath: "/img/100/test.png", wantStatus: http.StatusFound, wantLocation: "/img/50/test.png"},
+		{name: "width and height", urlPath: "/img/200x150/test.png", wantStatus: http.StatusFound, wantLocation: "/img/40x30/test.png"},
+		{name: "no allowed size within source", urlPath: "/img/300x100/test.png?fit=fill", wantStatus: http.StatusOK, wantBody: "capped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			service.Serve(rec, httptest.NewRequest(http.MethodGet, tt.urlPath, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Serve() = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if location := rec.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+// TestService_Serve_EnlargeCapped verifies capped sizes are served in place of upscaled ones,
+// including width-only sizes and signed requests under the redirect policy.
+func TestService_Serve_EnlargeCapped(t *testing.T) {
+	testDir := t.TempDir()
+	cacheDir := t.TempDir()
+	createPNG(t, filepath.Join(testDir, "test.png"), 80, 60)
+
+	presets := map[string]utils.ImagePreset{"lg": {Width: 4000, Fit: "contain"}}
+	cached := &Service{Config: &config.Image{}}
+	_, direct, _ := parseSize("80", "", nil)
+	writeCachedImage(t, cached, testDir, cacheDir, "test.png", "", ".png", direct, "direct 80")
+	writeCachedImage(t, cached, testDir, cacheDir, "test.png", "lg", ".png", sizeParts{width: 80, fit: FitModeContain, hasSize: true}, "lg 80")
+
+	signkey := middleware.Signkey{Secret: "secret"}
+	sign := func(path string) string {
+		expires := time.Now().Add(time.Hour).Unix()
+		return fmt.Sprintf("%s?expires=%d&token=%s", path, expires, signkey.Token(path, expires))
+	}
+
+	tests := []struct {
+		name     string
+		enlarge  EnlargePolicy
+		url      string
+		wantBody string
+	}{
+		{name: "width only never", enlarge: EnlargeNever, url: "/img/4000/test.png", wantBody: "direct 80"},
+		{name: "signed width only redirect", enlarge: EnlargeRedirect, url: sign("/img/4000/test.png"), wantBody: "direct 80"},
+		{name: "signed preset redirect", enlarge: EnlargeRedirect, url: sign("/img/lg/test.png"), wantBody: "lg 80"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &Service{
+				Config: &config.Image{
+					Directory: testDir,
+					Presets:   presets,
+					CacheDir:  cacheDir,
+					Formats:   []string{"png"},
+					Enlarge:   string(tt.enlarge),
+				},
+			}
+			handler := signkey.Verify(http.HandlerFunc(service.Serve))
+			if !strings.Contains(tt.url, "token=") {
+				handler = http.HandlerFunc(service.Serve)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if status := rec.Result().StatusCode; status != http.StatusOK {
+				t.Fatalf("Serve() = %d, want %d (Location %q)", status, http.StatusOK, rec.Header().Get("Location"))
+			}
+			if body := rec.Body.String(); body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
 // createTestImage creates a placeholder image file for Serve tests.
 func createTestImage(t *testing.T, path string) {
 	createEmptyFile(t, path)
@@ -0,0 +1,50 @@
+package image
+
+import (
+	"assetgoblin/middleware"
+	"assetgoblin/utils"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// sizeSpecs returns the parsed allowed sizes, parsing the configuration on first use.
+// Invalid entries are skipped; they are rejected when the configuration is loaded.
+func (s *Service) sizeSpecs() []utils.SizeSpec {
+	s.sizeSpecsOnce.Do(func() {
+		for _, size := range s.Config.AllowedSizes.Sizes {
+			spec, err := utils.ParseSizeSpec(size)
+			if err != nil {
+				slog.Warn("Ignoring invalid allowed size", "size", size, "error", err)
+				continue
+			}
+			s.parsedSizeSpecs = append(s.parsedSizeSpecs, spec)
+		}
+	})
+	return s.parsedSizeSpecs
+}
+
+// allowedSize checks a direct size against the allowed sizes.
+// It returns the nearest allowed size as a size string, which equals the requested size if it is allowed,
+// and false if no allowed size applies to the request. Requests carrying a valid signature token bypass
+// the allowlist if configured, and every size is allowed when the allowlist is empty.
+func (s *Service) allowedSize(req *http.Request, parts sizeParts) (string, bool) {
+	requested := strconv.Itoa(parts.width)
+	if parts.height > 0 {
+		requested += "x" + strconv.Itoa(parts.height)
+	}
+
+	specs := s.sizeSpecs()
+	if len(specs) == 0 || (s.Config.AllowedSizes.SignedBypass && middleware.HasValidToken(req)) {
+		return requested, true
+	}
+
+	width, height, ok := utils.NearestSize(specs, parts.width, parts.height)
+	if !ok {
+		return "", false
+	}
+	if height > 0 {
+		return strconv.Itoa(width) + "x" + strconv.Itoa(height), true
+	}
+	return strconv.Itoa(width), true
+}
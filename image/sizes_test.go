@@ -0,0 +1,164 @@
+package image
+
+import (
+	"assetgoblin/config"
+	"assetgoblin/middleware"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestService_Serve_AllowedSizes verifies reject, snap and redirect handling of direct sizes.
+func TestService_Serve_AllowedSizes(t *testing.T) {
+	testDir := t.TempDir()
+	cacheDir := t.TempDir()
+	createEmptyFile(t, filepath.Join(testDir, "test.jpg"))
+
+	_, parts, _ := parseSize("640x480", "", nil)
+	writeCachedImage(t, &Service{Config: &config.Image{}}, testDir, cacheDir, "test.jpg", "", ".jpg", parts, "snapped")
+
+	tests := []struct {
+		name         string
+		mode         string
+		signed       bool
+		urlPath      string
+		wantStatus   int
+		wantLocation string
+		wantBody     string
+	}{
+		{name: "reject disallowed size", mode: "reject", urlPath: "/img/641x480/test.jpg", wantStatus: http.StatusBadRequest},
+		{name: "reject width without width entries", mode: "snap", urlPath: "/img/641/test.jpg", wantStatus: http.StatusBadRequest},
+		{name: "allowed size", mode: "reject", urlPath: "/img/640x480/test.jpg", wantStatus: http.StatusOK, wantBody: "snapped"},
+		{name: "snap to nearest size", mode: "snap", urlPath: "/img/642x481/test.jpg", wantStatus: http.StatusOK, wantBody: "snapped"},
+		{
+			name:         "redirect to nearest size",
+			mode:         "redirect",
+			urlPath:      "/img/642x481/test.jpg?rotate=90",
+			wantStatus:   http.StatusFound,
+			wantLocation: "/img/640x480/test.jpg?rotate=90",
+		},
+		{name: "signed request snaps instead of redirecting", mode: "redirect", signed: true, urlPath: "/img/642x481/test.jpg", wantStatus: http.StatusOK, wantBody: "snapped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &Service{
+				Config: &config.Image{
+					Directory:    testDir,
+					CacheDir:     cacheDir,
+					Formats:      []string{"jpg"},
+					AllowedSizes: config.AllowedSizes{Sizes: []string{"640x480", "1024x768"}, Mode: tt.mode},
+				},
+			}
+
+			var handler http.Handler = http.HandlerFunc(service.Serve)
+			urlPath := tt.urlPath
+			if tt.signed {
+				signkey := middleware.Signkey{Secret: "secret"}
+				handler = signkey.Verify(handler)
+				expires := time.Now().Add(time.Hour).Unix()
+				urlPath += fmt.Sprintf("?expires=%d&token=%s", expires, signkey.Token(tt.urlPath, expires))
+			}
+
+			req := httptest.NewRequest(http.MethodGet, urlPath, nil)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if status := rec.Result().StatusCode; status != tt.wantStatus {
+				t.Fatalf("Serve() = %d, want %d", status, tt.wantStatus)
+			}
+			if location := rec.Header().Get("Location"); location != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+// TestService_AllowedSize_SignedBypass verifies that verified signed requests bypass the allowlist.
+func TestService_AllowedSize_SignedBypass(t *testing.T) {
+	service := &Service{
+		Config: &config.Image{
+			AllowedSizes: config.AllowedSizes{Sizes: []string{"640"}, Mode: "reject", SignedBypass: true},
+		},
+	}
+	parts := sizeParts{width: 641}
+
+	req := httptest.NewRequest(http.MethodGet, "/img/641/test.jpg", nil)
+	if size, ok := service.allowedSize(req, parts); !ok || size != "640" {
+		t.Errorf("allowedSize() unsigned = %q, %v, want %q, true", size, ok, "640")
+	}
+
+	signkey := middleware.Signkey{Secret: "secret"}
+	var verifiedReq *http.Request
+	handler := signkey.Verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verifiedReq = r
+	}))
+	expires := time.Now().Add(time.Hour).Unix()
+	target := fmt.Sprintf("/img/641/test.jpg?expires=%d&token=%s", expires, signkey.Token("/img/641/test.jpg", expires))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+	if verifiedReq == nil {
+		t.Fatalf("signed request was rejected")
+	}
+
+	if size, ok := service.allowedSize(verifiedReq, parts); !ok || size != "641" {
+		t.Errorf("allowedSize() signed = %q, %v, want %q, true", size, ok, "641")
+	}
+
+	derived := verifiedReq.Clone(verifiedReq.Context())
+	derived.URL.RawQuery = ""
+	if size, ok := service.allowedSize(derived, parts); !ok || size != "640" {
+		t.Errorf("allowedSize() without the verified token = %q, %v, want %q, true", size, ok, "640")
+	}
+}
+
+// TestService_Serve_AllowedSizes_Unsigned verifies unsigned requests don't bypass the allowlist
+// when a secret is configured.
+func TestService_Serve_AllowedSizes_Unsigned(t *testing.T) {
+	testDir := t.TempDir()
+	cacheDir := t.TempDir()
+	createEmptyFile(t, filepath.Join(testDir, "test.jpg"))
+
+	_, parts, _ := parseSize("640", "", nil)
+	writeCachedImage(t, &Service{Config: &config.Image{}}, testDir, cacheDir, "test.jpg", "", ".jpg", parts, "snapped")
+
+	service := &Service{
+		Config: &config.Image{
+			Directory:    testDir,
+			CacheDir:     cacheDir,
+			Formats:      []string{"jpg"},
+			AllowedSizes: config.AllowedSizes{Sizes: []string{"640"}, Mode: "snap", SignedBypass: true},
+		},
+	}
+	signkey := middleware.Signkey{Secret: "secret", LegacyTokens: true}
+	handler := signkey.Verify(http.HandlerFunc(service.Serve))
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "unsigned", url: "/img/641/test.jpg", wantStatus: http.StatusUnauthorized},
+		{name: "token of another path", url: "/img/641/test.jpg?token=" + signkey.Token("/img/640/test.jpg", 0), wantStatus: http.StatusUnauthorized},
+		{name: "signed allowed size", url: "/img/640/test.jpg?token=" + signkey.Token("/img/640/test.jpg", 0), wantStatus: http.StatusOK, wantBody: "snapped"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if status := rec.Result().StatusCode; status != tt.wantStatus {
+				t.Fatalf("Serve() = %d, want %d", status, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
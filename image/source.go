@@ -0,0 +1,65 @@
+package image
+
+import (
+	"assetgoblin/utils"
+	"context"
+	"fmt"
+	stdimage "image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// sourceDimensions returns the width and height of the image at path.
+// It decodes only the image header for formats supported by the standard library
+// and falls back to vipsheader, then ImageMagick identify, for everything else.
+// The external tools are started with run, so they are traced and killed on shutdown.
+func (s *Service) sourceDimensions(ctx context.Context, path string) (int, int, error) {
+	if file, err := os.Open(path); err == nil {
+		cfg, _, err := stdimage.DecodeConfig(file)
+		utils.CloseFile(file)
+		if err == nil {
+			return cfg.Width, cfg.Height, nil
+		}
+	}
+
+	if width, err := s.output(ctx, exec.Command("vipsheader", "-f", "width", path)); err == nil {
+		if height, err := s.output(ctx, exec.Command("vipsheader", "-f", "height", path)); err == nil {
+			return parseDimensions(width + "x" + height)
+		}
+	}
+
+	name := "identify"
+	args := []string{"-format", "%wx%h", path + "[0]"}
+	if runtime.GOOS == "windows" {
+		name = "magick"
+		args = append([]string{"identify"}, args...)
+	}
+	out, err := s.output(ctx, exec.Command(name, args...))
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to read image dimensions: %w", err)
+	}
+	return parseDimensions(out)
+}
+
+// parseDimensions parses a "WxH" string as reported by the external image tools.
+func parseDimensions(value string) (int, int, error) {
+	w, h, ok := strings.Cut(value, "x")
+	if !ok {
+		return 0, 0, fmt.Errorf("unexpected dimensions %q", value)
+	}
+	width, err := strconv.Atoi(w)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected width %q", w)
+	}
+	height, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unexpected height %q", h)
+	}
+	return width, height, nil
+}
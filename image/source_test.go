@@ -0,0 +1,102 @@
+package image
+
+import (
+	"assetgoblin/config"
+	"context"
+	"errors"
+	stdimage "image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestSourceDimensions verifies header-based dimension detection for decodable images.
+func TestSourceDimensions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.png")
+	createPNG(t, path, 64, 48)
+
+	width, height, err := (&Service{Config: &config.Image{}}).sourceDimensions(context.Background(), path)
+	if err != nil {
+		t.Fatalf("sourceDimensions() error = %v", err)
+	}
+	if width != 64 || height != 48 {
+		t.Errorf("sourceDimensions() = %dx%d, want 64x48", width, height)
+	}
+}
+
+// TestSourceDimensions_Probe verifies that undecodable sources are probed with vipsheader
+// through run, so the probe is refused once the service is shutting down.
+func TestSourceDimensions_Probe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	binDir := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$2\" = width ]; then echo 640; else echo 480; fi\n"
+	if err := os.WriteFile(filepath.Join(binDir, "vipsheader"), []byte(script), 0o755); err != nil {
+		t.Fatalf("Failed to write fake vipsheader: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	path := filepath.Join(t.TempDir(), "test.webp")
+	if err := os.WriteFile(path, []byte("not an image"), 0o644); err != nil {
+		t.Fatalf("Failed to write test image: %v", err)
+	}
+
+	service := &Service{Config: &config.Image{}}
+	width, height, err := service.sourceDimensions(context.Background(), path)
+	if err != nil {
+		t.Fatalf("sourceDimensions() error = %v", err)
+	}
+	if width != 640 || height != 480 {
+		t.Errorf("sourceDimensions() = %dx%d, want 640x480", width, height)
+	}
+
+	service.Shutdown()
+	if _, _, err := service.sourceDimensions(context.Background(), path); !errors.Is(err, errShuttingDown) {
+		t.Errorf("sourceDimensions() after Shutdown error = %v, want %v", err, errShuttingDown)
+	}
+}
+
+// TestParseDimensions verifies parsing of WxH output from external tools.
+func TestParseDimensions(t *testing.T) {
+	tests := []struct {
+		value      string
+		wantWidth  int
+		wantHeight int
+		wantErr    bool
+	}{
+		{value: "640x480", wantWidth: 640, wantHeight: 480},
+		{value: "640", wantErr: true},
+		{value: "ax480", wantErr: true},
+		{value: "640xb", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			width, height, err := parseDimensions(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDimensions(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if width != tt.wantWidth || height != tt.wantHeight {
+				t.Errorf("parseDimensions(%q) = %dx%d, want %dx%d", tt.value, width, height, tt.wantWidth, tt.wantHeight)
+			}
+		})
+	}
+}
+
+// createPNG writes a blank PNG image with the given dimensions.
+func createPNG(t *testing.T, path string, width, height int) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create test image %s: %v", path, err)
+	}
+	defer file.Close()
+
+	if err := png.Encode(file, stdimage.NewGray(stdimage.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("Failed to encode test image %s: %v", path, err)
+	}
+}
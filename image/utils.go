@@ -6,18 +6,28 @@ import (
 	"assetgoblin/config"
 	"assetgoblin/utils"
 	"fmt"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // Service handles image processing and serving operations.
 // It uses the configuration provided to determine how to process and serve images.
 type Service struct {
-	Config *config.Image
+	Config    *config.Image
+	HTTPCache *config.HTTPCache
+	PublicDir string // PublicDir is the public directory, which must not be inside the cache directory
+
+	sizeSpecsOnce   sync.Once
+	parsedSizeSpecs []utils.SizeSpec
+	sourceChecks    sourceChecks
+	procs           processes
+	cacheSize       cacheSize
 }
 
 // findImage searches for an image file with any of the supported formats.
@@ -34,6 +44,34 @@ func (s *Service) findImage(base string) (string, bool) {
 	return "", false
 }
 
+// findFallback resolves the fallback source configured for the requested image path.
+// Prefixes match whole path segments, so "products" matches "products/a.jpg" but not "products-archive/a.jpg".
+// The longest matching prefix rule wins; the default source is used when no rule matches.
+// Returns the full path of the fallback image and true if it exists, or an empty string and false otherwise.
+func (s *Service) findFallback(imageDir, path string) (string, bool) {
+	source := s.Config.Fallback.Source
+	matched := -1
+	for _, rule := range s.Config.Fallback.Prefixes {
+		prefix := strings.Trim(rule.Prefix, "/")
+		if path != prefix && !strings.HasPrefix(path, prefix+"/") && prefix != "" {
+			continue
+		}
+		if len(prefix) > matched {
+			source = rule.Source
+			matched = len(prefix)
+		}
+	}
+	if source == "" {
+		return "", false
+	}
+
+	fullPath := filepath.Join(imageDir, source)
+	if _, err := os.Stat(fullPath); err != nil {
+		return "", false
+	}
+	return fullPath, true
+}
+
 // isValidFormat checks if the given format is supported by the service.
 // Returns true if the format is supported, false otherwise.
 func (s *Service) isValidFormat(format string) bool {
@@ -44,25 +82,41 @@ type sizeParts struct {
 	width      int
 	height     int
 	fit        FitMode
+	background string
 	hasSize    bool
 	rotate     int
 	flip       string
 	crop       string
+	extract    *utils.ExtractArea
+	extractPx  [4]int
+	sourceSize [2]int
 	brightness float64
 	contrast   float64
 	gamma      float64
 	filters    []string
 }
 
+// parseFitMode parses a fit mode name. Returns false for unknown modes.
+func parseFitMode(value string) (FitMode, bool) {
+	switch fit := FitMode(value); fit {
+	case FitModeContain, FitModeCover, FitModeFill, FitModeInside, FitModeOutside, FitModePad:
+		return fit, true
+	}
+	return "", false
+}
+
 // parseSize parses a preset name, size string (e.g., "640" or "640x480"), or direct dimensions.
 // It checks presets first, then falls back to direct size parsing.
+// A valid queryFit overrides the fit mode of the preset.
 // Returns resize option string, size parts (including transforms), and whether it's a preset.
 func parseSize(presetOrSize, queryFit string, presets map[string]utils.ImagePreset) (string, sizeParts, bool) {
 	preset, isPreset := presets[presetOrSize]
 	if isPreset {
-		fit := FitModeContain
-		if preset.Fit == "cover" || queryFit == "cover" {
-			fit = FitModeCover
+		fit, ok := parseFitMode(queryFit)
+		if !ok {
+			if fit, ok = parseFitMode(preset.Fit); !ok {
+				fit = FitModeContain
+			}
 		}
 
 		width := preset.Width
@@ -73,14 +127,28 @@ func parseSize(presetOrSize, queryFit string, presets map[string]utils.ImagePres
 			resizeOption = strconv.Itoa(width) + "x" + strconv.Itoa(height)
 		}
 
+		var extract *utils.ExtractArea
+		if preset.Extract != "" {
+			if area, err := utils.ParseExtract(preset.Extract); err == nil {
+				extract = &area
+			}
+		}
+
+		background := ""
+		if preset.Background != "" {
+			background, _ = utils.ParseColor(preset.Background)
+		}
+
 		parts := sizeParts{
 			width:      width,
 			height:     height,
 			fit:        fit,
+			background: background,
 			hasSize:    width > 0,
 			rotate:     preset.Rotate,
 			flip:       preset.Flip,
 			crop:       preset.Crop,
+			extract:    extract,
 			brightness: preset.Brightness,
 			contrast:   preset.Contrast,
 			gamma:      preset.Gamma,
@@ -106,9 +174,9 @@ func parseSize(presetOrSize, queryFit string, presets map[string]utils.ImagePres
 			return "", sizeParts{}, false
 		}
 
-		fit := FitModeContain
-		if queryFit == "cover" {
-			fit = FitModeCover
+		fit, ok := parseFitMode(queryFit)
+		if !ok {
+			fit = FitModeContain
 		}
 
 		return strconv.Itoa(width) + "x" + strconv.Itoa(height), sizeParts{
@@ -124,44 +192,182 @@ func parseSize(presetOrSize, queryFit string, presets map[string]utils.ImagePres
 		return "", sizeParts{}, false
 	}
 
-	return strconv.Itoa(width), sizeParts{width: width, hasSize: false}, false
+	return strconv.Itoa(width), sizeParts{width: width, fit: FitModeContain, hasSize: true}, false
 }
 
-// buildVipsCommand builds a libvips command for image processing.
-func buildVipsCommand(input, output string, resizeOption string, parts sizeParts) *exec.Cmd {
+// buildVipsCommands builds the libvips commands for image processing, to be run one after another.
+// If an extract area is set, it is cut out of the input by a separate command before any other operation.
+func buildVipsCommands(input, output string, resizeOption string, parts sizeParts) []*exec.Cmd {
+	if parts.extract != nil {
+		tmp := strings.TrimSuffix(output, filepath.Ext(output)) + "_e" + filepath.Ext(output)
+		rest := parts
+		rest.extract = nil
+		extract := exec.Command("vips", "extract_area", input, tmp,
+			strconv.Itoa(parts.extractPx[0]), strconv.Itoa(parts.extractPx[1]),
+			strconv.Itoa(parts.extractPx[2]), strconv.Itoa(parts.extractPx[3]))
+		return append([]*exec.Cmd{extract}, buildVipsCommands(tmp, output, resizeOption, rest)...)
+	}
+
 	if !parts.hasSize && parts.rotate == 0 && parts.flip == "" && len(parts.filters) == 0 {
-		return exec.Command("vips", "copy", input, output)
+		return []*exec.Cmd{exec.Command("vips", "copy", input, output)}
 	}
 
 	hasTransforms := parts.rotate > 0 || parts.flip != "" || len(parts.filters) > 0
 
 	if parts.hasSize {
-		if parts.fit == FitModeCover {
-			if hasTransforms {
-				tmp := strings.TrimSuffix(output, filepath.Ext(output)) + "_tmp." + filepath.Ext(output)
-				cmd := exec.Command("vips", "cover", input, tmp, strconv.Itoa(parts.width), strconv.Itoa(parts.height))
-				cmd = addVipsTransforms(cmd, tmp, output, parts)
-				return cmd
-			}
-			return exec.Command("vips", "cover", input, output, strconv.Itoa(parts.width), strconv.Itoa(parts.height))
-		}
 		if hasTransforms {
 			tmp := strings.TrimSuffix(output, filepath.Ext(output)) + "_tmp." + filepath.Ext(output)
-			cmd := exec.Command("vips", "thumbnail", input, tmp, resizeOption)
-			cmd = addVipsTransforms(cmd, tmp, output, parts)
-			return cmd
+			cmds := vipsResizeCommands(input, tmp, resizeOption, parts)
+			cmds[len(cmds)-1] = addVipsTransforms(cmds[len(cmds)-1], tmp, output, parts)
+			return cmds
 		}
-		return exec.Command("vips", "thumbnail", input, output, resizeOption)
+		return vipsResizeCommands(input, output, resizeOption, parts)
 	}
 
 	if hasTransforms {
 		tmp := strings.TrimSuffix(output, filepath.Ext(output)) + "_tmp." + filepath.Ext(output)
 		cmd := exec.Command("vips", "copy", input, tmp)
-		cmd = addVipsTransforms(cmd, tmp, output, parts)
-		return cmd
+		return []*exec.Cmd{addVipsTransforms(cmd, tmp, output, parts)}
+	}
+
+	return []*exec.Cmd{exec.Command("vips", "copy", input, output)}
+}
+
+// vipsResizeCommands returns the vips commands resizing input into output according to the fit mode.
+// Pad mode needs a second command embedding the thumbnail into the background.
+func vipsResizeCommands(input, output string, resizeOption string, parts sizeParts) []*exec.Cmd {
+	width, height := strconv.Itoa(parts.width), strconv.Itoa(parts.height)
+
+	switch parts.fit {
+	case FitModeCover:
+		return []*exec.Cmd{exec.Command("vips", "cover", input, output, width, height)}
+	case FitModeFill:
+		return []*exec.Cmd{exec.Command("vips", "thumbnail", input, output, width, "--height", height, "--size", "force")}
+	case FitModeOutside:
+		w, h := outsideSize(parts)
+		return []*exec.Cmd{exec.Command("vips", "thumbnail", input, output, strconv.Itoa(w), "--height", strconv.Itoa(h))}
+	case FitModePad:
+		tmp := strings.TrimSuffix(output, filepath.Ext(output)) + "_p" + filepath.Ext(output)
+		return []*exec.Cmd{
+			exec.Command("vips", "thumbnail", input, tmp, resizeOption),
+			exec.Command("vips", "gravity", tmp, output, "centre", width, height,
+				"--extend", "background", "--background", vipsColor(background(parts))),
+		}
+	}
+
+	return []*exec.Cmd{exec.Command("vips", "thumbnail", input, output, resizeOption)}
+}
+
+// outsideSize returns the smallest dimensions preserving the source aspect ratio
+// that are at least as large as the requested width and height.
+// Falls back to the requested dimensions if the source size is unknown.
+func outsideSize(parts sizeParts) (int, int) {
+	sourceWidth, sourceHeight := effectiveSourceSize(parts)
+	if sourceWidth <= 0 || sourceHeight <= 0 {
+		return parts.width, parts.height
+	}
+
+	scale := math.Max(float64(parts.width)/float64(sourceWidth), float64(parts.height)/float64(sourceHeight))
+	return int(math.Ceil(float64(sourceWidth) * scale)), int(math.Ceil(float64(sourceHeight) * scale))
+}
+
+// effectiveSourceSize returns the dimensions of the image entering the resize step,
+// which is the extract area if one is set or the source image otherwise.
+func effectiveSourceSize(parts sizeParts) (int, int) {
+	if parts.extract != nil {
+		return parts.extractPx[2], parts.extractPx[3]
+	}
+	return parts.sourceSize[0], parts.sourceSize[1]
+}
+
+// scaleFactor returns the factor by which the source is scaled to produce the requested size.
+// A factor above 1 means the image would be upscaled. Returns 0 if the source size is unknown.
+func scaleFactor(parts sizeParts) float64 {
+	sourceWidth, sourceHeight := effectiveSourceSize(parts)
+	if sourceWidth <= 0 || sourceHeight <= 0 {
+		return 0
 	}
 
-	return exec.Command("vips", "copy", input, output)
+	scaleX := float64(parts.width) / float64(sourceWidth)
+	if parts.height <= 0 {
+		return scaleX
+	}
+	scaleY := float64(parts.height) / float64(sourceHeight)
+
+	switch parts.fit {
+	case FitModeCover, FitModeOutside, FitModeFill:
+		return math.Max(scaleX, scaleY)
+	}
+	return math.Min(scaleX, scaleY)
+}
+
+// capToSource shrinks the requested dimensions of parts so that the source is not upscaled.
+// Returns the resize option for the capped dimensions and true if the dimensions were changed.
+func capToSource(parts *sizeParts) (string, bool) {
+	scale := scaleFactor(*parts)
+	if scale <= 1 {
+		return "", false
+	}
+
+	parts.width = max(1, int(float64(parts.width)/scale))
+	if parts.height <= 0 {
+		return strconv.Itoa(parts.width), true
+	}
+	parts.height = max(1, int(float64(parts.height)/scale))
+	return strconv.Itoa(parts.width) + "x" + strconv.Itoa(parts.height), true
+}
+
+// enlargeRedirectTarget returns the preset or size of the largest variant that does not upscale the source.
+// For direct sizes this is the capped size, or the largest allowed size within it if sizes are restricted;
+// for presets it is the widest preset with the same fit mode that does not upscale the source.
+// Returns false if no such size or preset exists.
+func (s *Service) enlargeRedirectTarget(isPreset bool, capped sizeParts, cappedOption string) (string, bool) {
+	if !isPreset {
+		specs := s.sizeSpecs()
+		if len(specs) == 0 {
+			return cappedOption, true
+		}
+		width, height, ok := utils.LargestSizeWithin(specs, capped.width, capped.height)
+		if !ok {
+			return "", false
+		}
+		if height > 0 {
+			return strconv.Itoa(width) + "x" + strconv.Itoa(height), true
+		}
+		return strconv.Itoa(width), true
+	}
+
+	target := ""
+	bestWidth := 0
+	for name, preset := range s.Config.Presets {
+		candidate := capped
+		candidate.width, candidate.height = preset.Width, preset.Height
+		if string(capped.fit) != preset.Fit || scaleFactor(candidate) > 1 {
+			continue
+		}
+		if preset.Width > bestWidth || (preset.Width == bestWidth && name < target) {
+			target, bestWidth = name, preset.Width
+		}
+	}
+	return target, target != ""
+}
+
+// background returns the normalized background color of parts or the default background.
+func background(parts sizeParts) string {
+	if parts.background != "" {
+		return parts.background
+	}
+	return defaultBackground
+}
+
+// vipsColor converts a normalized hex color into a space-separated vips band list.
+func vipsColor(color string) string {
+	bands := make([]string, 0, len(color)/2)
+	for i := 0; i+1 < len(color); i += 2 {
+		v, _ := strconv.ParseUint(color[i:i+2], 16, 8)
+		bands = append(bands, strconv.FormatUint(v, 10))
+	}
+	return strings.Join(bands, " ")
 }
 
 // addVipsTransforms adds image transformation operations to a vips command.
@@ -250,16 +456,29 @@ func addVipsTransforms(cmd *exec.Cmd, input, output string, parts sizeParts) *ex
 
 // buildConvertCommand builds an ImageMagick convert command for image processing.
 func buildConvertCommand(prefix, input, output string, resizeOption string, parts sizeParts) *exec.Cmd {
-	args := []string{}
+	args := []string{input}
+
+	if parts.extract != nil {
+		args = append(args, "-crop", fmt.Sprintf("%dx%d+%d+%d", parts.extractPx[2], parts.extractPx[3], parts.extractPx[0], parts.extractPx[1]), "+repage")
+	}
 
 	if parts.hasSize {
-		if parts.fit == FitModeCover {
-			args = append(args, input, "-resize", resizeOption+"^", "-gravity", "center", "-extent", resizeOption)
-		} else {
-			args = append(args, input, "-resize", resizeOption)
+		switch parts.fit {
+		case FitModeCover:
+			args = append(args, "-resize", resizeOption+"^", "-gravity", "center", "-extent", resizeOption)
+		case FitModeFill:
+			args = append(args, "-resize", resizeOption+"!")
+		case FitModeOutside:
+			args = append(args, "-resize", resizeOption+"^")
+		case FitModePad:
+			color := "#" + background(parts)
+			if strings.HasSuffix(color, "00") && len(color) == 9 {
+				color = "none"
+			}
+			args = append(args, "-resize", resizeOption, "-background", color, "-gravity", "center", "-extent", resizeOption)
+		default:
+			args = append(args, "-resize", resizeOption)
 		}
-	} else {
-		args = append(args, input)
 	}
 
 	if parts.brightness != 0 || parts.contrast != 0 {
@@ -3,8 +3,12 @@ package image
 import (
 	"assetgoblin/config"
 	"assetgoblin/utils"
+	"context"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
 )
@@ -78,6 +82,46 @@ func TestService_FindImage(t *testing.T) {
 	}
 }
 
+// TestService_FindFallback verifies prefix rules match whole path segments and the longest rule wins.
+func TestService_FindFallback(t *testing.T) {
+	testDir := t.TempDir()
+	for _, name := range []string{"placeholder.jpg", "products.jpg", "shoes.jpg"} {
+		createEmptyFile(t, filepath.Join(testDir, name))
+	}
+
+	s := &Service{
+		Config: &config.Image{
+			Fallback: config.ImageFallback{
+				Source: "placeholder.jpg",
+				Prefixes: []config.FallbackRule{
+					{Prefix: "products", Source: "products.jpg"},
+					{Prefix: "products/shoes/", Source: "shoes.jpg"},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "prefix directory", path: "products/a.jpg", want: "products.jpg"},
+		{name: "longest prefix", path: "products/shoes/a.jpg", want: "shoes.jpg"},
+		{name: "prefix without segment boundary", path: "products-archive/a.jpg", want: "placeholder.jpg"},
+		{name: "no matching prefix", path: "people/a.jpg", want: "placeholder.jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := s.findFallback(testDir, tt.path)
+			if !found || got != filepath.Join(testDir, tt.want) {
+				t.Errorf("findFallback() = %q, %v, want %q", got, found, tt.want)
+			}
+		})
+	}
+}
+
 // TestService_IsValidFormat verifies format validation against configured extensions.
 func TestService_IsValidFormat(t *testing.T) {
 	tests := []struct {
@@ -158,8 +202,8 @@ func TestParseSize(t *testing.T) {
 			input:          "640",
 			fitParam:       "",
 			wantOutput:     "640",
-			wantHasSize:    false,
-			wantFitContain: false,
+			wantHasSize:    true,
+			wantFitContain: true,
 		},
 		{
 			name:           "width x height default fit",
@@ -393,6 +437,261 @@ func TestParseSizeWithPresets(t *testing.T) {
 	}
 }
 
+// TestBuildCommands_Extract verifies that extract areas are applied before resizing in both backends.
+func TestBuildCommands_Extract(t *testing.T) {
+	area, err := utils.ParseExtract("10,20,300,200")
+	if err != nil {
+		t.Fatalf("ParseExtract() error = %v", err)
+	}
+	parts := sizeParts{width: 100, height: 100, fit: FitModeContain, hasSize: true, extract: &area, extractPx: [4]int{10, 20, 300, 200}}
+
+	vips := commandLines(buildVipsCommands("in.jpg", "out.jpg", "100x100", parts))
+	if want := []string{"vips extract_area in.jpg out_e.jpg 10 20 300 200", "vips thumbnail out_e.jpg out.jpg 100x100"}; !slices.Equal(vips, want) {
+		t.Errorf("buildVipsCommands() = %q, want %q", vips, want)
+	}
+
+	convert := strings.Join(buildConvertCommand("", "in.jpg", "out.jpg", "100x100", parts).Args, " ")
+	if want := "convert in.jpg -crop 300x200+10+20 +repage -resize 100x100 out.jpg"; convert != want {
+		t.Errorf("buildConvertCommand() = %q, want %q", convert, want)
+	}
+}
+
+// TestService_RunAll_Vips verifies every generated libvips command is a single invocation the vips CLI accepts.
+// The commands run against a stand-in for vips that checks its arguments, and against vips itself if installed.
+func TestService_RunAll_Vips(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	area, err := utils.ParseExtract("10,20,300,200")
+	if err != nil {
+		t.Fatalf("ParseExtract() error = %v", err)
+	}
+	tests := []struct {
+		name         string
+		resizeOption string
+		parts        sizeParts
+		wantSize     [2]int
+	}{
+		{
+			name:     "extract",
+			parts:    sizeParts{extract: &area, extractPx: [4]int{10, 20, 300, 200}},
+			wantSize: [2]int{300, 200},
+		},
+		{
+			name:         "extract and resize",
+			resizeOption: "150x150",
+			parts:        sizeParts{width: 150, height: 150, fit: FitModeContain, hasSize: true, extract: &area, extractPx: [4]int{10, 20, 300, 200}},
+			wantSize:     [2]int{150, 100},
+		},
+		{
+			name:         "pad",
+			resizeOption: "200x200",
+			parts:        sizeParts{width: 200, height: 200, fit: FitModePad, hasSize: true},
+			wantSize:     [2]int{200, 200},
+		},
+		{
+			name:         "extract and pad",
+			resizeOption: "100x100",
+			parts:        sizeParts{width: 100, height: 100, fit: FitModePad, hasSize: true, extract: &area, extractPx: [4]int{10, 20, 300, 200}},
+			wantSize:     [2]int{100, 100},
+		},
+	}
+
+	for _, backend := range []string{"fake", "vips"} {
+		for _, tt := range tests {
+			t.Run(backend+" "+tt.name, func(t *testing.T) {
+				if backend == "vips" {
+					if _, err := exec.LookPath("vips"); err != nil {
+						t.Skip("vips is not installed")
+					}
+				} else {
+					installFakeVips(t)
+				}
+				dir := t.TempDir()
+				input := filepath.Join(dir, "in.png")
+				output := filepath.Join(dir, "out.png")
+				createPNG(t, input, 400, 300)
+
+				service := &Service{Config: &config.Image{}}
+				if err := service.runAll(context.Background(), buildVipsCommands(input, output, tt.resizeOption, tt.parts)); err != nil {
+					t.Fatalf("runAll() error = %v", err)
+				}
+				if backend == "fake" {
+					return
+				}
+				if width, height, err := service.sourceDimensions(context.Background(), output); err != nil || [2]int{width, height} != tt.wantSize {
+					t.Errorf("output size = %dx%d (%v), want %dx%d", width, height, err, tt.wantSize[0], tt.wantSize[1])
+				}
+			})
+		}
+	}
+}
+
+// installFakeVips puts a stand-in for the vips CLI first in PATH. It accepts only a single operation
+// with an existing input and copies the input to the output, so chained or shell-dependent commands fail.
+func installFakeVips(t *testing.T) {
+	t.Helper()
+
+	dir := t.TempDir()
+	script := `#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in
+	"&&" | ";" | "|") echo "unexpected argument $arg" >&2; exit 1 ;;
+	esac
+done
+[ -f "$2" ] || { echo "missing input $2" >&2; exit 1; }
+cp "$2" "$3"
+`
+	if err := os.WriteFile(filepath.Join(dir, "vips"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake vips: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// commandLines returns the space-joined arguments of each command.
+func commandLines(cmds []*exec.Cmd) []string {
+	lines := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		lines[i] = strings.Join(cmd.Args, " ")
+	}
+	return lines
+}
+
+// TestBuildCommands_FitModes verifies resize arguments for every fit mode in both backends.
+func TestBuildCommands_FitModes(t *testing.T) {
+	tests := []struct {
+		name        string
+		parts       sizeParts
+		wantVips    []string
+		wantConvert string
+	}{
+		{
+			name:        "contain",
+			parts:       sizeParts{width: 200, height: 100, fit: FitModeContain, hasSize: true},
+			wantVips:    []string{"vips thumbnail in.jpg out.jpg 200x100"},
+			wantConvert: "convert in.jpg -resize 200x100 out.jpg",
+		},
+		{
+			name:        "fill",
+			parts:       sizeParts{width: 200, height: 100, fit: FitModeFill, hasSize: true},
+			wantVips:    []string{"vips thumbnail in.jpg out.jpg 200 --height 100 --size force"},
+			wantConvert: "convert in.jpg -resize 200x100! out.jpg",
+		},
+		{
+			name:        "inside",
+			parts:       sizeParts{width: 200, height: 100, fit: FitModeInside, hasSize: true},
+			wantVips:    []string{"vips thumbnail in.jpg out.jpg 200x100"},
+			wantConvert: "convert in.jpg -resize 200x100 out.jpg",
+		},
+		{
+			name:        "outside",
+			parts:       sizeParts{width: 200, height: 100, fit: FitModeOutside, hasSize: true, sourceSize: [2]int{400, 400}},
+			wantVips:    []string{"vips thumbnail in.jpg out.jpg 200 --height 200"},
+			wantConvert: "convert in.jpg -resize 200x100^ out.jpg",
+		},
+		{
+			name:        "pad with default background",
+			parts:       sizeParts{width: 200, height: 100, fit: FitModePad, hasSize: true},
+			wantVips:    []string{"vips thumbnail in.jpg out_p.jpg 200x100", "vips gravity out_p.jpg out.jpg centre 200 100 --extend background --background 255 255 255"},
+			wantConvert: "convert in.jpg -resize 200x100 -background #ffffff -gravity center -extent 200x100 out.jpg",
+		},
+		{
+			name:        "pad with transparent background",
+			parts:       sizeParts{width: 200, height: 100, fit: FitModePad, background: "00000000", hasSize: true},
+			wantVips:    []string{"vips thumbnail in.jpg out_p.jpg 200x100", "vips gravity out_p.jpg out.jpg centre 200 100 --extend background --background 0 0 0 0"},
+			wantConvert: "convert in.jpg -resize 200x100 -background none -gravity center -extent 200x100 out.jpg",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := commandLines(buildVipsCommands("in.jpg", "out.jpg", "200x100", tt.parts)); !slices.Equal(got, tt.wantVips) {
+				t.Errorf("buildVipsCommands() = %q, want %q", got, tt.wantVips)
+			}
+			if got := strings.Join(buildConvertCommand("", "in.jpg", "out.jpg", "200x100", tt.parts).Args, " "); got != tt.wantConvert {
+				t.Errorf("buildConvertCommand() = %q, want %q", got, tt.wantConvert)
+			}
+		})
+	}
+}
+
+// TestParseFitMode verifies fit mode parsing and query overrides of preset fit modes.
+func TestParseFitMode(t *testing.T) {
+	for _, fit := range []FitMode{FitModeContain, FitModeCover, FitModeFill, FitModeInside, FitModeOutside, FitModePad} {
+		if got, ok := parseFitMode(string(fit)); !ok || got != fit {
+			t.Errorf("parseFitMode(%q) = %q, %v, want %q, true", fit, got, ok, fit)
+		}
+	}
+	if _, ok := parseFitMode("stretch"); ok {
+		t.Errorf("parseFitMode(%q) ok = true, want false", "stretch")
+	}
+
+	presets := map[string]utils.ImagePreset{"banner": {Width: 800, Height: 200, Fit: "pad", Background: "000000"}}
+	if _, parts, _ := parseSize("banner", "", presets); parts.fit != FitModePad || parts.background != "000000" {
+		t.Errorf("parseSize() fit = %q, background = %q, want %q, %q", parts.fit, parts.background, FitModePad, "000000")
+	}
+	if _, parts, _ := parseSize("banner", "fill", presets); parts.fit != FitModeFill {
+		t.Errorf("parseSize() with query fit = %q, want %q", parts.fit, FitModeFill)
+	}
+	if _, parts, _ := parseSize("640x480", "outside", nil); parts.fit != FitModeOutside {
+		t.Errorf("parseSize() direct size fit = %q, want %q", parts.fit, FitModeOutside)
+	}
+}
+
+// TestCapToSource verifies that requested sizes are capped to avoid upscaling.
+func TestCapToSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		parts      sizeParts
+		wantOption string
+		wantCapped bool
+	}{
+		{
+			name:       "width only larger than source",
+			parts:      sizeParts{width: 4000, fit: FitModeContain, sourceSize: [2]int{300, 200}},
+			wantOption: "300",
+			wantCapped: true,
+		},
+		{
+			name:       "contain keeps box aspect ratio",
+			parts:      sizeParts{width: 1000, height: 1000, fit: FitModeContain, sourceSize: [2]int{300, 200}},
+			wantOption: "300x300",
+			wantCapped: true,
+		},
+		{
+			name:       "cover uses the larger scale",
+			parts:      sizeParts{width: 600, height: 100, fit: FitModeCover, sourceSize: [2]int{300, 200}},
+			wantOption: "300x50",
+			wantCapped: true,
+		},
+		{
+			name:       "extract area is the effective source",
+			parts:      sizeParts{width: 400, fit: FitModeContain, sourceSize: [2]int{3000, 2000}, extract: &utils.ExtractArea{}, extractPx: [4]int{0, 0, 200, 100}},
+			wantOption: "200",
+			wantCapped: true,
+		},
+		{
+			name:       "downscale is unchanged",
+			parts:      sizeParts{width: 100, height: 100, fit: FitModeContain, sourceSize: [2]int{300, 200}},
+			wantCapped: false,
+		},
+		{
+			name:       "unknown source size is unchanged",
+			parts:      sizeParts{width: 4000, fit: FitModeContain},
+			wantCapped: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			option, capped := capToSource(&tt.parts)
+			if capped != tt.wantCapped || option != tt.wantOption {
+				t.Errorf("capToSource() = %q, %v, want %q, %v", option, capped, tt.wantOption, tt.wantCapped)
+			}
+		})
+	}
+}
+
 // TestEnsureAbsolute verifies path resolution for relative and absolute paths.
 func TestEnsureAbsolute(t *testing.T) {
 	tests := []struct {
@@ -0,0 +1,212 @@
+package image
+
+import (
+	"assetgoblin/utils"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// WarmOptions selects the derivatives produced by Warm.
+type WarmOptions struct {
+	Formats     []string              // Formats to produce; all configured formats if empty
+	Presets     []string              // Presets to produce; all configured presets if empty
+	Include     []string              // Include limits sources to paths matching any of these globs
+	Exclude     []string              // Exclude skips sources with paths matching any of these globs
+	Concurrency int                   // Concurrency is the number of parallel conversions; the number of CPUs if 0
+	DryRun      bool                  // DryRun only lists the jobs without producing anything
+	Progress    func(done, total int) // Progress is called after each finished job
+}
+
+// WarmJob is a derivative to produce: a source image path relative to the image directory,
+// a preset and an output format.
+type WarmJob struct {
+	Source string
+	Preset string
+	Format string
+}
+
+// WarmFailure is a job that failed, along with its error.
+type WarmFailure struct {
+	Job WarmJob
+	Err error
+}
+
+// WarmResult reports the outcome of a Warm run.
+type WarmResult struct {
+	Jobs      []WarmJob
+	Generated int
+	Cached    int
+	Skipped   int
+	Failures  []WarmFailure
+}
+
+// Warm pre-generates the derivatives of every source image in the image directory for the
+// selected presets and formats. It uses the same pipeline and cache paths as Serve, so warmed
+// derivatives are hit by requests without query parameters. Derivatives that are cached and up
+// to date are left alone; presets redirected by the enlarge policy are skipped.
+func (s *Service) Warm(opts WarmOptions) (WarmResult, error) {
+	var result WarmResult
+
+	formats := opts.Formats
+	if len(formats) == 0 {
+		formats = s.Config.Formats
+	}
+	for _, format := range formats {
+		if !s.isValidFormat(format) {
+			return result, fmt.Errorf("unsupported format %q", format)
+		}
+	}
+
+	presets := opts.Presets
+	if len(presets) == 0 {
+		for name := range s.Config.Presets {
+			presets = append(presets, name)
+		}
+		sort.Strings(presets)
+	}
+	for _, preset := range presets {
+		if _, ok := s.Config.Presets[preset]; !ok {
+			return result, fmt.Errorf("unknown preset %q", preset)
+		}
+	}
+
+	for _, pattern := range slices.Concat(opts.Include, opts.Exclude) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return result, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+	}
+
+	wd, _ := os.Getwd()
+	imageDir := ensureAbsolute(s.Config.Directory, wd)
+	cacheDir := ensureAbsolute(s.Config.CacheDir, wd)
+
+	sources, err := s.warmSources(imageDir, opts.Include, opts.Exclude)
+	if err != nil {
+		return result, err
+	}
+	for _, source := range sources {
+		for _, preset := range presets {
+			for _, format := range formats {
+				result.Jobs = append(result.Jobs, WarmJob{Source: source, Preset: preset, Format: format})
+			}
+		}
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan WarmJob)
+	done := 0
+	for range concurrency {
+		wg.Go(func() {
+			for job := range jobs {
+				generated, skipped, err := s.warmJob(imageDir, cacheDir, job)
+
+				mu.Lock()
+				switch {
+				case err != nil:
+					result.Failures = append(result.Failures, WarmFailure{Job: job, Err: err})
+				case skipped:
+					result.Skipped++
+				case generated:
+					result.Generated++
+				default:
+					result.Cached++
+				}
+				done++
+				if opts.Progress != nil {
+					opts.Progress(done, len(result.Jobs))
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	for _, job := range result.Jobs {
+		jobs <- job
+	}
+	close(jobs)
+	wg.Wait()
+
+	return result, nil
+}
+
+// warmSources lists the source images in imageDir matching the include and exclude globs,
+// relative to imageDir. Images sharing a path without extension are listed once,
+// as the one Serve would use.
+func (s *Service) warmSources(imageDir string, include, exclude []string) ([]string, error) {
+	var sources []string
+	seen := map[string]bool{}
+
+	err := filepath.WalkDir(imageDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !s.isValidFormat(strings.ToLower(filepath.Ext(file))) {
+			return nil
+		}
+
+		base := strings.TrimSuffix(file, filepath.Ext(file))
+		if seen[base] {
+			return nil
+		}
+		seen[base] = true
+
+		found, ok := s.findImage(base)
+		if !ok {
+			return nil
+		}
+		rel, err := filepath.Rel(imageDir, found)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if (len(include) > 0 && !utils.MatchesGlob(include, rel)) || utils.MatchesGlob(exclude, rel) {
+			return nil
+		}
+		sources = append(sources, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list source images: %w", err)
+	}
+
+	return sources, nil
+}
+
+// warmJob produces a single derivative. Returns whether it was generated,
+// or skipped because the enlarge policy redirects its requests.
+func (s *Service) warmJob(imageDir, cacheDir string, job WarmJob) (bool, bool, error) {
+	resizeOption, parts, _ := parseSize(job.Preset, "", s.Config.Presets)
+	if err := s.checkOutputLimits(parts); err != nil {
+		return false, false, err
+	}
+
+	ctx := context.Background()
+	source := filepath.Join(imageDir, filepath.FromSlash(job.Source))
+	d, target, err := s.resolveDerivative(ctx, imageDir, cacheDir, source, job.Preset, "."+job.Format, resizeOption, parts, true)
+	if err != nil {
+		return false, false, err
+	}
+	if target != "" {
+		return false, true, nil
+	}
+
+	backend, err := s.ensureDerivative(ctx, imageDir, d)
+	return backend != "", false, err
+}
@@ -0,0 +1,112 @@
+package image
+
+import (
+	"assetgoblin/config"
+	"assetgoblin/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestService_Warm_DryRun verifies jobs cover every preset and format of the selected sources.
+func TestService_Warm_DryRun(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    WarmOptions
+		want    []string
+		wantErr bool
+	}{
+		{name: "all sources", opts: WarmOptions{Formats: []string{"webp"}}, want: []string{"a.jpg", "photos/b.png", "photos/c.jpg"}},
+		{name: "include directory", opts: WarmOptions{Formats: []string{"webp"}, Include: []string{"photos/*"}}, want: []string{"photos/b.png", "photos/c.jpg"}},
+		{name: "exclude by name", opts: WarmOptions{Formats: []string{"webp"}, Exclude: []string{"*.png"}}, want: []string{"a.jpg", "photos/c.jpg"}},
+		{name: "unsupported format", opts: WarmOptions{Formats: []string{"bmp"}}, wantErr: true},
+		{name: "unknown preset", opts: WarmOptions{Presets: []string{"huge"}}, wantErr: true},
+		{name: "invalid glob", opts: WarmOptions{Include: []string{"["}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := createWarmService(t)
+			tt.opts.DryRun = true
+
+			result, err := service.Warm(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Warm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var sources []string
+			for _, job := range result.Jobs {
+				if !slices.Contains(sources, job.Source) {
+					sources = append(sources, job.Source)
+				}
+			}
+			if !slices.Equal(sources, tt.want) {
+				t.Errorf("Warm() sources = %v, want %v", sources, tt.want)
+			}
+			if len(result.Jobs) != 2*len(tt.want) {
+				t.Errorf("Warm() jobs = %d, want %d", len(result.Jobs), 2*len(tt.want))
+			}
+			if result.Generated+result.Cached+len(result.Failures) != 0 {
+				t.Errorf("Warm() produced derivatives in dry-run mode: %+v", result)
+			}
+		})
+	}
+}
+
+// TestService_Warm verifies cached derivatives are hit and failures are reported per job.
+func TestService_Warm(t *testing.T) {
+	service := createWarmService(t)
+	imageDir, cacheDir := service.Config.Directory, service.Config.CacheDir
+
+	_, parts, _ := parseSize("small", "", service.Config.Presets)
+	writeCachedImage(t, service, imageDir, cacheDir, "a.jpg", "small", ".webp", parts, "cached")
+
+	progress := 0
+	result, err := service.Warm(WarmOptions{
+		Formats:     []string{"webp"},
+		Presets:     []string{"small"},
+		Include:     []string{"a.jpg", "photos/b.png"},
+		Concurrency: 2,
+		Progress:    func(done, total int) { progress = done },
+	})
+	if err != nil {
+		t.Fatalf("Warm() error = %v", err)
+	}
+
+	if result.Cached != 1 {
+		t.Errorf("Warm() cached = %d, want 1", result.Cached)
+	}
+	if len(result.Failures) != 1 || result.Failures[0].Job.Source != "photos/b.png" {
+		t.Errorf("Warm() failures = %+v, want photos/b.png", result.Failures)
+	}
+	if progress != 2 {
+		t.Errorf("Progress() done = %d, want 2", progress)
+	}
+}
+
+// createWarmService creates an image directory with a duplicate base name and returns a service for it.
+func createWarmService(t *testing.T) *Service {
+	t.Helper()
+
+	imageDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(imageDir, "photos"), 0755); err != nil {
+		t.Fatalf("Failed to create image directory: %v", err)
+	}
+	for _, source := range []string{"a.jpg", "a.png", "photos/b.png", "photos/c.jpg", "notes.txt"} {
+		createEmptyFile(t, filepath.Join(imageDir, source))
+	}
+
+	return &Service{Config: &config.Image{
+		Directory: imageDir,
+		CacheDir:  t.TempDir(),
+		Formats:   []string{"jpg", "png", "webp"},
+		Presets: map[string]utils.ImagePreset{
+			"small": {Width: 100, Fit: "contain"},
+			"large": {Width: 800, Fit: "contain"},
+		},
+	}}
+}
@@ -64,14 +64,86 @@ func printConfig() {
 		{"port", conf.Port},
 		{"public_dir", conf.PublicDir},
 		{"secret", conf.Secret},
+		{"signing.clock_skew", conf.Signing.ClockSkew.String()},
+		{"signing.legacy_tokens", strconv.FormatBool(conf.Signing.LegacyTokens)},
+		{"security.content_security_policy", conf.Security.ContentSecurityPolicy},
+		{"security.content_type_options", conf.Security.ContentTypeOptions},
+		{"security.cross_origin_resource_policy", conf.Security.CrossOriginResourcePolicy},
+		{"security.referrer_policy", conf.Security.ReferrerPolicy},
+		{"security.directory_listing", strconv.FormatBool(conf.Security.DirectoryListing)},
+		{"security.hide_dotfiles", strconv.FormatBool(conf.Security.HideDotfiles)},
+		{"security.hidden", strings.Join(conf.Security.Hidden, ", ")},
+		{"shutdown_timeout", conf.ShutdownTimeout.String()},
+		{"listen.socket", conf.Listen.Socket},
+		{"listen.socket_mode", conf.Listen.SocketMode},
+		{"metrics.path", conf.Metrics.Path},
+		{"tracing.endpoint", conf.Tracing.Endpoint},
+		{"tracing.sample_rate", strconv.FormatFloat(conf.Tracing.SampleRate, 'g', -1, 64)},
+		{"tracing.service_name", conf.Tracing.ServiceName},
+		{"tls.cert_file", conf.TLS.CertFile},
+		{"tls.key_file", conf.TLS.KeyFile},
+		{"tls.min_version", conf.TLS.MinVersion},
+		{"tls.redirect_port", conf.TLS.RedirectPort},
+		{"access_log.format", conf.AccessLog.Format},
+		{"access_log.output", conf.AccessLog.Output},
+		{"access_log.sampling", strconv.Itoa(len(conf.AccessLog.Sampling))},
+		{"admin.path", conf.Admin.Path},
+		{"admin.token", conf.Admin.Token},
+		{"assets.cache_control", conf.Assets.CacheControl},
+		{"assets.hash_length", strconv.Itoa(conf.Assets.HashLength)},
+		{"assets.include", strings.Join(conf.Assets.Include, ", ")},
+		{"assets.exclude", strings.Join(conf.Assets.Exclude, ", ")},
+		{"assets.manifest", conf.Assets.Manifest},
+		{"assets.stale", conf.Assets.Stale},
+		{"cors.images.allowed_origins", strings.Join(conf.CORS.Images.AllowedOrigins, ", ")},
+		{"cors.images.allowed_methods", strings.Join(conf.CORS.Images.AllowedMethods, ", ")},
+		{"cors.images.allowed_headers", strings.Join(conf.CORS.Images.AllowedHeaders, ", ")},
+		{"cors.images.exposed_headers", strings.Join(conf.CORS.Images.ExposedHeaders, ", ")},
+		{"cors.images.allow_credentials", strconv.FormatBool(conf.CORS.Images.AllowCredentials)},
+		{"cors.images.max_age", conf.CORS.Images.MaxAge.String()},
+		{"cors.public.allowed_origins", strings.Join(conf.CORS.Public.AllowedOrigins, ", ")},
+		{"cors.public.allowed_methods", strings.Join(conf.CORS.Public.AllowedMethods, ", ")},
+		{"cors.public.allowed_headers", strings.Join(conf.CORS.Public.AllowedHeaders, ", ")},
+		{"cors.public.exposed_headers", strings.Join(conf.CORS.Public.ExposedHeaders, ", ")},
+		{"cors.public.allow_credentials", strconv.FormatBool(conf.CORS.Public.AllowCredentials)},
+		{"cors.public.max_age", conf.CORS.Public.MaxAge.String()},
+		{"compression.precompressed", strconv.FormatBool(conf.Compression.Precompressed)},
+		{"compression.dynamic", strconv.FormatBool(conf.Compression.Dynamic)},
+		{"compression.min_size", strconv.FormatInt(conf.Compression.MinSize, 10)},
+		{"compression.types", strings.Join(conf.Compression.Types, ", ")},
+		{"compression.cache_dir", conf.Compression.CacheDir},
+		{"http_cache.etag", strconv.FormatBool(conf.HTTPCache.ETag)},
+		{"http_cache.last_modified", strconv.FormatBool(conf.HTTPCache.LastModified)},
+		{"http_cache.errors", conf.HTTPCache.Errors},
+		{"http_cache.images", conf.HTTPCache.Images},
+		{"http_cache.public", strconv.Itoa(len(conf.HTTPCache.Public))},
 		{"rate_limit.limit", strconv.Itoa(conf.RateLimit.Limit)},
 		{"rate_limit.ttl", conf.RateLimit.Ttl.String()},
 		{"image.avif_through_vips", strconv.FormatBool(conf.Image.AvifThroughVips)},
 		{"image.cache_dir", conf.Image.CacheDir},
+		{"image.cache_version", conf.Image.CacheVersion},
+		{"image.gc.interval", conf.Image.GC.Interval.String()},
+		{"image.gc.min_age", conf.Image.GC.MinAge.String()},
+		{"image.source_check", conf.Image.SourceCheck},
+		{"image.source_check_interval", conf.Image.SourceCheckInterval.String()},
 		{"image.directory", conf.Image.Directory},
 		{"image.path", conf.Image.Path},
+		{"image.enlarge", conf.Image.Enlarge},
+		{"image.strict_params", strconv.FormatBool(conf.Image.StrictParams)},
+		{"image.allowed_sizes.sizes", strings.Join(conf.Image.AllowedSizes.Sizes, ", ")},
+		{"image.allowed_sizes.mode", conf.Image.AllowedSizes.Mode},
+		{"image.allowed_sizes.signed_bypass", strconv.FormatBool(conf.Image.AllowedSizes.SignedBypass)},
+		{"image.limits.max_width", strconv.Itoa(conf.Image.Limits.MaxWidth)},
+		{"image.limits.max_height", strconv.Itoa(conf.Image.Limits.MaxHeight)},
+		{"image.limits.max_pixels", strconv.FormatInt(conf.Image.Limits.MaxPixels, 10)},
+		{"image.limits.max_source_pixels", strconv.FormatInt(conf.Image.Limits.MaxSourcePixels, 10)},
+		{"image.limits.max_source_bytes", strconv.FormatInt(conf.Image.Limits.MaxSourceBytes, 10)},
 		{"image.formats", strings.Join(conf.Image.Formats, ", ")},
 		{"image.presets", strings.Join(presets, ", ")},
+		{"image.fallback.source", conf.Image.Fallback.Source},
+		{"image.fallback.prefixes", strconv.Itoa(len(conf.Image.Fallback.Prefixes))},
+		{"image.fallback.status", strconv.Itoa(conf.Image.Fallback.Status)},
+		{"image.fallback.max_age", conf.Image.Fallback.MaxAge.String()},
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
@@ -4,6 +4,7 @@ package main
 
 import (
 	"assetgoblin/config"
+	"assetgoblin/image"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -22,10 +23,24 @@ func main() {
 	versionFlag := flag.Bool("version", false, "Print version info")
 	flag.BoolVar(versionFlag, "v", false, "Print version info (shorthand)")
 	updateFlag := flag.Bool("update", false, "Update to latest version")
+	purgeFlag := flag.Bool("purge", false, "Purge cached derivatives selected by -source, -preset and -prefix")
+	sourceFlag := flag.String("source", "", "Source image path relative to the image directory (with -purge)")
+	presetFlag := flag.String("preset", "", "Preset name (with -purge or -cache-warm)")
+	prefixFlag := flag.String("prefix", "", "Source image path prefix (with -purge)")
+	cacheWarmFlag := flag.Bool("cache-warm", false, "Pre-generate every configured preset for all source images")
+	formatsFlag := flag.String("formats", "", "Comma-separated output formats, all configured formats if empty (with -cache-warm)")
+	includeFlag := flag.String("include", "", "Comma-separated globs of source images to include (with -cache-warm)")
+	excludeFlag := flag.String("exclude", "", "Comma-separated globs of source images to exclude (with -cache-warm)")
+	concurrencyFlag := flag.Int("concurrency", 0, "Number of parallel conversions, the number of CPUs if 0 (with -cache-warm)")
+	manifestFlag := flag.Bool("manifest", false, "Write the manifest of content-hashed URLs of files in the public directory")
+	compressFlag := flag.Bool("compress", false, "Write precompressed siblings of compressible files in the public directory")
+	gcFlag := flag.Bool("gc", false, "Remove cached derivatives that can no longer be served")
+	dryRunFlag := flag.Bool("dry-run", false, "List the affected derivatives without changing anything (with -cache-warm or -gc)")
 	flag.Parse()
 
 	if *serveFlag {
 		serve()
+		os.Exit(0)
 	} else if *printConfigFlag {
 		printConfig()
 		os.Exit(0)
@@ -46,6 +61,28 @@ func main() {
 		os.Exit(0)
 	} else if *updateFlag {
 		update()
+	} else if *purgeFlag {
+		purgeCache(image.PurgeFilter{Source: *sourceFlag, Preset: *presetFlag, Prefix: *prefixFlag})
+		os.Exit(0)
+	} else if *cacheWarmFlag {
+		warmCache(image.WarmOptions{
+			Formats:     splitList(*formatsFlag),
+			Presets:     splitList(*presetFlag),
+			Include:     splitList(*includeFlag),
+			Exclude:     splitList(*excludeFlag),
+			Concurrency: *concurrencyFlag,
+			DryRun:      *dryRunFlag,
+		})
+		os.Exit(0)
+	} else if *gcFlag {
+		gcCache(*dryRunFlag)
+		os.Exit(0)
+	} else if *manifestFlag {
+		writeManifest()
+		os.Exit(0)
+	} else if *compressFlag {
+		precompress()
+		os.Exit(0)
 	}
 
 	fmt.Println(Logo, "\nServe static files or dynamically manipulated images with ease")
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// requests counts the served requests.
+var requests = NewCounterVec("assetgoblin_http_requests_total",
+	"HTTP requests by route, status code and image preset.", "route", "status", "preset")
+
+// labelsKey is the context key of the labels of an instrumented request.
+type labelsKey struct{}
+
+// requestLabels holds the labels set by handlers further down the chain.
+type requestLabels struct {
+	preset string
+}
+
+// Instrument counts requests by route, status code and preset. route names the route of a request;
+// handlers can set the preset label with SetPreset.
+func Instrument(handler http.Handler, route func(*http.Request) string) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		labels := &requestLabels{}
+		writer := &statusWriter{ResponseWriter: res}
+		handler.ServeHTTP(writer, req.WithContext(context.WithValue(req.Context(), labelsKey{}, labels)))
+
+		status := writer.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		requests.Inc(route(req), strconv.Itoa(status), labels.preset)
+	})
+}
+
+// SetPreset sets the preset label of an instrumented request.
+func SetPreset(req *http.Request, preset string) {
+	if labels, ok := req.Context().Value(labelsKey{}).(*requestLabels); ok {
+		labels.preset = preset
+	}
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,281 @@
+// Package metrics provides counters, histograms and gauges exposed in the Prometheus text format.
+// Metrics are created as package variables of the instrumented packages and registered in Default.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default is the registry exposed by the metrics endpoint.
+var Default = &Registry{}
+
+// DurationBuckets are histogram buckets in seconds suited to image conversions.
+var DurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// metric is a named metric writing its series in the text format.
+type metric interface {
+	desc() *desc
+	write(w io.Writer, d *desc)
+}
+
+// desc describes a metric and its label names.
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+// Registry is a set of metrics written in the Prometheus text format.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+// register adds m to the registry, panicking on duplicate names like a duplicate flag would.
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.metrics {
+		if existing.desc().name == m.desc().name {
+			panic("metrics: duplicate metric " + m.desc().name)
+		}
+	}
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes all metrics sorted by name.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	metrics := slices.Clone(r.metrics)
+	r.mu.Unlock()
+
+	slices.SortFunc(metrics, func(a, b metric) int { return strings.Compare(a.desc().name, b.desc().name) })
+	for _, m := range metrics {
+		d := m.desc()
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, escapeHelp(d.help), d.name, d.kind)
+		m.write(w, d)
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-store")
+	r.Write(res)
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	d      desc
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounterVec creates a counter with the given label names and registers it in Default.
+// A counter without labels is exposed as 0 before it is first incremented.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{d: desc{name: name, help: help, kind: "counter", labels: labels}, values: map[string]float64{}}
+	if len(labels) == 0 {
+		c.values[""] = 0
+	}
+	Default.register(c)
+	return c
+}
+
+// Inc increments the counter of the label values by 1.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v to the counter of the label values.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := c.d.key(labelValues)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Value returns the counter of the label values.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	key := c.d.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *CounterVec) desc() *desc { return &c.d }
+
+func (c *CounterVec) write(w io.Writer, d *desc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", d.name, d.labelPairs(key, ""), formatFloat(c.values[key]))
+	}
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	d       desc
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogram
+}
+
+// histogram holds the non-cumulative bucket counts, sum and count of observations.
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec creates a histogram with the given upper bucket bounds and label names
+// and registers it in Default.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		d:       desc{name: name, help: help, kind: "histogram", labels: labels},
+		buckets: slices.Sorted(slices.Values(buckets)),
+		values:  map[string]*histogram{},
+	}
+	Default.register(h)
+	return h
+}
+
+// Observe adds an observation to the histogram of the label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.d.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hist := h.values[key]
+	if hist == nil {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hist
+	}
+	if i, _ := slices.BinarySearch(h.buckets, v); i < len(h.buckets) {
+		hist.counts[i]++
+	}
+	hist.sum += v
+	hist.count++
+}
+
+// Count returns the number of observations of the label values.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	key := h.d.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if hist := h.values[key]; hist != nil {
+		return hist.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) desc() *desc { return &h.d }
+
+func (h *HistogramVec) write(w io.Writer, d *desc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, key := range sortedKeys(h.values) {
+		hist := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hist.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", d.name, d.labelPairs(key, formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", d.name, d.labelPairs(key, "+Inf"), hist.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", d.name, d.labelPairs(key, ""), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", d.name, d.labelPairs(key, ""), hist.count)
+	}
+}
+
+// GaugeFunc is a gauge whose value is computed when the metrics are written.
+type GaugeFunc struct {
+	d  desc
+	fn func() float64
+}
+
+// NewGaugeFunc creates a gauge reporting the value of fn and registers it in Default.
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{d: desc{name: name, help: help, kind: "gauge"}, fn: fn}
+	Default.register(g)
+	return g
+}
+
+func (g *GaugeFunc) desc() *desc { return &g.d }
+
+func (g *GaugeFunc) write(w io.Writer, d *desc) {
+	fmt.Fprintf(w, "%s %s\n", d.name, formatFloat(g.fn()))
+}
+
+// labelSeparator joins label values into map keys; it cannot occur in valid UTF-8 text.
+const labelSeparator = "\xff"
+
+// key joins the label values, panicking if their number does not match the label names.
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, labelSeparator)
+}
+
+// labelPairs formats the labels of a series, adding the "le" label of a histogram bucket if set.
+func (d *desc) labelPairs(key, le string) string {
+	var pairs []string
+	if len(d.labels) > 0 {
+		for i, value := range strings.Split(key, labelSeparator) {
+			pairs = append(pairs, d.labels[i]+`="`+escapeLabel(value)+`"`)
+		}
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sortedKeys returns the keys of m in order, so series are written deterministically.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// formatFloat formats a sample value as in the text format.
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escapeHelp escapes backslashes and line feeds in help texts.
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
+
+// escapeLabel escapes backslashes, line feeds and double quotes in label values.
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test metrics are registered once, so tests can be repeated with -count.
+var (
+	testCounter   = NewCounterVec("test_write_requests_total", "Requests\nby path.", "path")
+	_             = NewCounterVec("test_write_unused_total", "Unused counter.")
+	testHistogram = NewHistogramVec("test_write_duration_seconds", "Durations.", []float64{1, 0.5}, "backend")
+	_             = NewGaugeFunc("test_write_bytes", "Bytes.", func() float64 { return 1024 })
+)
+
+// TestRegistry_Write verifies metrics are written in the Prometheus text format.
+func TestRegistry_Write(t *testing.T) {
+	testCounter.values = map[string]float64{}
+	testCounter.Inc(`/a"b`)
+	testCounter.Add(2, "/c")
+	testHistogram.values = map[string]*histogram{}
+	testHistogram.Observe(0.5, "vips")
+	testHistogram.Observe(0.75, "vips")
+	testHistogram.Observe(3, "vips")
+
+	var buf bytes.Buffer
+	Default.Write(&buf)
+	out := buf.String()
+
+	want := []string{
+		"# HELP test_write_requests_total Requests\\nby path.\n# TYPE test_write_requests_total counter\n",
+		"test_write_requests_total{path=\"/a\\\"b\"} 1\ntest_write_requests_total{path=\"/c\"} 2\n",
+		"# TYPE test_write_unused_total counter\ntest_write_unused_total 0\n",
+		"# TYPE test_write_duration_seconds histogram\n",
+		"test_write_duration_seconds_bucket{backend=\"vips\",le=\"0.5\"} 1\n",
+		"test_write_duration_seconds_bucket{backend=\"vips\",le=\"1\"} 2\n",
+		"test_write_duration_seconds_bucket{backend=\"vips\",le=\"+Inf\"} 3\n",
+		"test_write_duration_seconds_sum{backend=\"vips\"} 4.25\n",
+		"test_write_duration_seconds_count{backend=\"vips\"} 3\n",
+		"# TYPE test_write_bytes gauge\ntest_write_bytes 1024\n",
+	}
+	for _, line := range want {
+		if !strings.Contains(out, line) {
+			t.Errorf("output missing %q in:\n%s", line, out)
+		}
+	}
+	if strings.Index(out, "test_write_bytes") > strings.Index(out, "test_write_requests_total") {
+		t.Errorf("metrics not sorted by name")
+	}
+}
+
+// TestRegistry_Duplicate verifies registering a metric name twice panics.
+func TestRegistry_Duplicate(t *testing.T) {
+	registry := &Registry{}
+	registry.register(&CounterVec{d: desc{name: "test_duplicate_total"}})
+	defer func() {
+		if recover() == nil {
+			t.Errorf("register() with duplicate name did not panic")
+		}
+	}()
+	registry.register(&CounterVec{d: desc{name: "test_duplicate_total"}})
+}
+
+// TestInstrument verifies requests are counted by route, status and the preset set by the handler.
+func TestInstrument(t *testing.T) {
+	handler := Instrument(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		SetPreset(req, "thumbnail")
+		http.NotFound(res, req)
+	}), func(*http.Request) string { return "test_image" })
+
+	before := requests.Value("test_image", "404", "thumbnail")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/img/thumbnail/a.jpg", nil))
+	if got := requests.Value("test_image", "404", "thumbnail") - before; got != 1 {
+		t.Errorf("requests counted = %v, want 1", got)
+	}
+
+	ok := Instrument(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, _ = res.Write([]byte("ok"))
+	}), func(*http.Request) string { return "test_static" })
+	before = requests.Value("test_static", "200", "")
+	ok.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := requests.Value("test_static", "200", "") - before; got != 1 {
+		t.Errorf("requests counted for implicit 200 = %v, want 1", got)
+	}
+}
+
+// TestRegistry_ServeHTTP verifies the endpoint serves the text format content type.
+func TestRegistry_ServeHTTP(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Default.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want Prometheus text format", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "# TYPE assetgoblin_http_requests_total counter") {
+		t.Errorf("body missing request metrics:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,298 @@
+package middleware
+
+import (
+	"assetgoblin/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accessLogKey is the context key of the access log entry of a request.
+const accessLogKey contextKey = "accesslog.entry"
+
+// AccessLog is a middleware that writes a line per request in the configured format.
+// Use NewAccessLog to open the output.
+type AccessLog struct {
+	Config *config.AccessLog
+
+	mu     sync.Mutex
+	out    io.Writer
+	file   *os.File
+	random func() float64
+}
+
+// accessLogEntry holds the details of a request, including those set by handlers.
+type accessLogEntry struct {
+	time     time.Time
+	remote   string
+	method   string
+	uri      string
+	proto    string
+	status   int
+	bytes    int64
+	duration time.Duration
+	referer  string
+	agent    string
+	cache    string
+	backend  string
+}
+
+// NewAccessLog creates the access log middleware and opens its output.
+func NewAccessLog(cfg *config.AccessLog) (*AccessLog, error) {
+	a := &AccessLog{Config: cfg, random: rand.Float64}
+	switch cfg.Output {
+	case "stdout":
+		a.out = os.Stdout
+	case "stderr":
+		a.out = os.Stderr
+	default:
+		if err := a.Reopen(); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Reopen reopens the output file, so a rotated log file is replaced by a new one.
+// It does nothing when writing to stdout or stderr.
+func (a *AccessLog) Reopen() error {
+	if a.Config.Output == "stdout" || a.Config.Output == "stderr" {
+		return nil
+	}
+
+	file, err := os.OpenFile(a.Config.Output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+
+	a.mu.Lock()
+	previous := a.file
+	a.file, a.out = file, file
+	a.mu.Unlock()
+
+	if previous != nil {
+		return previous.Close()
+	}
+	return nil
+}
+
+// Close closes the output file.
+func (a *AccessLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	a.out = io.Discard
+	return err
+}
+
+// Log returns a middleware handler that logs every request after it was served,
+// unless it is dropped by the sampling rules.
+func (a *AccessLog) Log(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		entry := &accessLogEntry{
+			time:    time.Now(),
+			remote:  extractIP(req.RemoteAddr),
+			method:  req.Method,
+			uri:     req.RequestURI,
+			proto:   req.Proto,
+			referer: req.Referer(),
+			agent:   req.UserAgent(),
+		}
+		if entry.uri == "" {
+			entry.uri = req.URL.RequestURI()
+		}
+
+		writer := &accessLogWriter{ResponseWriter: res}
+		handler.ServeHTTP(writer, req.WithContext(context.WithValue(req.Context(), accessLogKey, entry)))
+
+		entry.status = writer.status
+		if entry.status == 0 {
+			entry.status = http.StatusOK
+		}
+		entry.bytes = writer.bytes
+		entry.duration = time.Since(entry.time)
+
+		if a.sampled(req.URL.Path, entry.status) {
+			a.write(entry)
+		}
+	})
+}
+
+// SetCacheResult records the cache result ("hit" or "miss") and the backend that generated
+// the response in the access log entry of the request.
+func SetCacheResult(req *http.Request, cache, backend string) {
+	if entry, ok := req.Context().Value(accessLogKey).(*accessLogEntry); ok {
+		entry.cache, entry.backend = cache, backend
+	}
+}
+
+// sampled reports whether a request is logged according to the first matching sampling rule.
+func (a *AccessLog) sampled(path string, status int) bool {
+	for _, rule := range a.Config.Sampling {
+		if strings.HasPrefix(path, rule.Prefix) && matchesStatus(rule.Status, status) {
+			return rule.Rate >= 1 || (rule.Rate > 0 && a.random() < rule.Rate)
+		}
+	}
+	return true
+}
+
+// matchesStatus reports whether status matches a code like "404", a class like "4xx" or an empty pattern.
+func matchesStatus(pattern string, status int) bool {
+	if pattern == "" {
+		return true
+	}
+	code := strconv.Itoa(status)
+	if strings.EqualFold(pattern[1:], "xx") {
+		return code[0] == pattern[0]
+	}
+	return code == pattern
+}
+
+// write formats the entry and writes it as a single line.
+func (a *AccessLog) write(entry *accessLogEntry) {
+	var line string
+	switch a.Config.Format {
+	case "common":
+		line = formatCommon(entry)
+	case "combined":
+		line = formatCommon(entry) + " " + quoteOrDash(entry.referer) + " " + quoteOrDash(entry.agent)
+	case "json":
+		line = formatJSON(entry)
+	case "logfmt":
+		line = formatLogfmt(entry)
+	default:
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, _ = io.WriteString(a.out, line+"\n")
+}
+
+// formatCommon formats the entry in the Common Log Format.
+func formatCommon(entry *accessLogEntry) string {
+	bytes := "-"
+	if entry.bytes > 0 {
+		bytes = strconv.FormatInt(entry.bytes, 10)
+	}
+	return fmt.Sprintf("%s - - [%s] %s %d %s",
+		entry.remote, entry.time.Format("02/Jan/2006:15:04:05 -0700"),
+		strconv.Quote(entry.method+" "+entry.uri+" "+entry.proto), entry.status, bytes)
+}
+
+// formatJSON formats the entry as a JSON object.
+func formatJSON(entry *accessLogEntry) string {
+	data, _ := json.Marshal(struct {
+		Time       string  `json:"time"`
+		Remote     string  `json:"remote"`
+		Method     string  `json:"method"`
+		URI        string  `json:"uri"`
+		Proto      string  `json:"proto"`
+		Status     int     `json:"status"`
+		Bytes      int64   `json:"bytes"`
+		DurationMS float64 `json:"duration_ms"`
+		Referer    string  `json:"referer,omitempty"`
+		UserAgent  string  `json:"user_agent,omitempty"`
+		Cache      string  `json:"cache,omitempty"`
+		Backend    string  `json:"backend,omitempty"`
+	}{
+		Time:       entry.time.Format(time.RFC3339Nano),
+		Remote:     entry.remote,
+		Method:     entry.method,
+		URI:        entry.uri,
+		Proto:      entry.proto,
+		Status:     entry.status,
+		Bytes:      entry.bytes,
+		DurationMS: float64(entry.duration.Microseconds()) / 1000,
+		Referer:    entry.referer,
+		UserAgent:  entry.agent,
+		Cache:      entry.cache,
+		Backend:    entry.backend,
+	})
+	return string(data)
+}
+
+// formatLogfmt formats the entry as logfmt key-value pairs, omitting empty optional values.
+func formatLogfmt(entry *accessLogEntry) string {
+	pairs := [][2]string{
+		{"time", entry.time.Format(time.RFC3339Nano)},
+		{"remote", entry.remote},
+		{"method", entry.method},
+		{"uri", entry.uri},
+		{"proto", entry.proto},
+		{"status", strconv.Itoa(entry.status)},
+		{"bytes", strconv.FormatInt(entry.bytes, 10)},
+		{"duration", entry.duration.String()},
+		{"referer", entry.referer},
+		{"user_agent", entry.agent},
+		{"cache", entry.cache},
+		{"backend", entry.backend},
+	}
+
+	var b strings.Builder
+	for _, pair := range pairs {
+		if pair[1] == "" {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(pair[0])
+		b.WriteByte('=')
+		if quoted := strconv.Quote(pair[1]); quoted[1:len(quoted)-1] != pair[1] || strings.ContainsAny(pair[1], " =") {
+			b.WriteString(quoted)
+		} else {
+			b.WriteString(pair[1])
+		}
+	}
+	return b.String()
+}
+
+// quoteOrDash quotes a header value for the Combined Log Format, using "-" for empty values.
+func quoteOrDash(value string) string {
+	if value == "" {
+		return `"-"`
+	}
+	return strconv.Quote(value)
+}
+
+// accessLogWriter records the status code and the number of bytes written.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessLogWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap returns the underlying response writer for http.ResponseController.
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
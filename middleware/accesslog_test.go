@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"assetgoblin/config"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// serveLogged serves a request through the access log with the given format and returns the written line.
+func serveLogged(t *testing.T, accessLog *AccessLog, req *http.Request) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	accessLog.out = &buf
+	handler := accessLog.Log(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		SetCacheResult(req, "miss", "vips")
+		res.WriteHeader(http.StatusCreated)
+		_, _ = res.Write([]byte("hello"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	return buf.String()
+}
+
+// TestAccessLog_Formats verifies each format records the request, status, bytes and cache details.
+func TestAccessLog_Formats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   *regexp.Regexp
+	}{
+		{format: "common", want: regexp.MustCompile(`^192\.0\.2\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /img/a\.jpg\?w=1 HTTP/1\.1" 201 5\n$`)},
+		{format: "combined", want: regexp.MustCompile(`^192\.0\.2\.1 - - \[.+\] "GET /img/a\.jpg\?w=1 HTTP/1\.1" 201 5 "https://example\.com/" "agent \\"quoted\\""\n$`)},
+		{format: "logfmt", want: regexp.MustCompile(`^time=\S+ remote=192\.0\.2\.1 method=GET uri="/img/a\.jpg\?w=1" proto=HTTP/1\.1 status=201 bytes=5 duration=\S+ referer=https://example\.com/ user_agent="agent \\"quoted\\"" cache=miss backend=vips\n$`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/img/a.jpg?w=1", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			req.Header.Set("Referer", "https://example.com/")
+			req.Header.Set("User-Agent", `agent "quoted"`)
+
+			line := serveLogged(t, &AccessLog{Config: &config.AccessLog{Format: tt.format}}, req)
+			if !tt.want.MatchString(line) {
+				t.Errorf("line = %q, want match of %s", line, tt.want)
+			}
+		})
+	}
+}
+
+// TestAccessLog_JSON verifies the JSON format contains every field.
+func TestAccessLog_JSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/img/a.jpg", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	line := serveLogged(t, &AccessLog{Config: &config.AccessLog{Format: "json"}}, req)
+
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("invalid JSON %q: %v", line, err)
+	}
+	want := map[string]any{"remote": "192.0.2.1", "method": "GET", "uri": "/img/a.jpg", "status": 201.0, "bytes": 5.0, "cache": "miss", "backend": "vips"}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["duration_ms"]; !ok {
+		t.Errorf("duration_ms missing in %q", line)
+	}
+}
+
+// TestAccessLog_Sampling verifies the first matching rule decides whether a request is logged.
+func TestAccessLog_Sampling(t *testing.T) {
+	accessLog := &AccessLog{
+		Config: &config.AccessLog{Sampling: []config.AccessLogRule{
+			{Prefix: "/healthz", Rate: 0},
+			{Prefix: "/img/", Status: "2xx", Rate: 0.1},
+			{Status: "404", Rate: 1},
+		}},
+		random: func() float64 { return 0.5 },
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		want   bool
+	}{
+		{path: "/healthz", status: http.StatusOK, want: false},
+		{path: "/img/a.jpg", status: http.StatusOK, want: false},
+		{path: "/img/a.jpg", status: http.StatusInternalServerError, want: true},
+		{path: "/missing", status: http.StatusNotFound, want: true},
+		{path: "/app.css", status: http.StatusOK, want: true},
+	}
+	for _, tt := range tests {
+		if got := accessLog.sampled(tt.path, tt.status); got != tt.want {
+			t.Errorf("sampled(%q, %d) = %v, want %v", tt.path, tt.status, got, tt.want)
+		}
+	}
+
+	accessLog.random = func() float64 { return 0.05 }
+	if !accessLog.sampled("/img/a.jpg", http.StatusOK) {
+		t.Errorf("sampled() within rate = false, want true")
+	}
+}
+
+// TestAccessLog_Reopen verifies the log file is recreated after it was rotated away.
+func TestAccessLog_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	accessLog, err := NewAccessLog(&config.AccessLog{Format: "common", Output: path})
+	if err != nil {
+		t.Fatalf("NewAccessLog() error = %v", err)
+	}
+	defer accessLog.Close()
+
+	handler := accessLog.Log(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/first", nil))
+
+	if err = os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("Failed to rotate log: %v", err)
+	}
+	if err = accessLog.Reopen(); err != nil {
+		t.Fatalf("Reopen() error = %v", err)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/second", nil))
+
+	for file, want := range map[string]string{path + ".1": "/first", path: "/second"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		if lines := strings.Count(string(data), "\n"); lines != 1 || !strings.Contains(string(data), want) {
+			t.Errorf("%s = %q, want a single line for %s", filepath.Base(file), data, want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// AdminToken is a middleware that protects administrative endpoints with a bearer token.
+type AdminToken struct {
+	Token string // Token is the secret expected in the Authorization header
+}
+
+// Verify returns a middleware handler that checks if the request carries the
+// configured token as "Authorization: Bearer <token>". If the token is missing
+// or invalid, a 401 Unauthorized response is returned.
+func (a *AdminToken) Verify(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if !a.Authorized(req) {
+			res.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler.ServeHTTP(res, req)
+	})
+}
+
+// Authorized reports whether the request carries the configured token as "Authorization: Bearer <token>".
+// No request is authorized if the token is empty.
+func (a *AdminToken) Authorized(req *http.Request) bool {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	return ok && a.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.Token)) == 1
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestAdminToken_Verify validates bearer token authorization for admin requests.
+func TestAdminToken_Verify(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		header     string
+		wantStatus int
+	}{
+		{name: "valid token", token: "secret", header: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "invalid token", token: "secret", header: "Bearer other", wantStatus: http.StatusUnauthorized},
+		{name: "missing header", token: "secret", header: "", wantStatus: http.StatusUnauthorized},
+		{name: "wrong scheme", token: "secret", header: "Basic secret", wantStatus: http.StatusUnauthorized},
+		{name: "unset token", token: "", header: "Bearer ", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			admin := AdminToken{Token: tt.token}
+			handler := admin.Verify(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/cache/purge", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Verify() status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"assetgoblin/config"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CORS is a middleware that applies the cross-origin resource sharing policy of the image path
+// to image requests and the policy of the public directory to all other requests.
+// ImagePath is empty if images are served as static files.
+type CORS struct {
+	Config    *config.CORS
+	ImagePath string
+}
+
+// Apply returns a middleware handler that answers preflight requests of allowed origins and adds
+// the CORS headers to responses for them. Preflight requests never reach the wrapped handler,
+// so they are not rejected for missing signatures; requests of other origins get no CORS headers.
+func (c *CORS) Apply(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		policy := &c.Config.Public
+		if c.ImagePath != "" && strings.HasPrefix(req.URL.Path, c.ImagePath) {
+			policy = &c.Config.Images
+		}
+		if len(policy.AllowedOrigins) == 0 {
+			handler.ServeHTTP(res, req)
+			return
+		}
+
+		header := res.Header()
+		header.Add("Vary", "Origin")
+
+		origin := req.Header.Get("Origin")
+		preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+		if origin == "" || !allowsOrigin(policy, origin) {
+			if preflight {
+				http.Error(res, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			handler.ServeHTTP(res, req)
+			return
+		}
+
+		if slices.Contains(policy.AllowedOrigins, "*") && !policy.AllowCredentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if policy.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if len(policy.ExposedHeaders) > 0 {
+				header.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+			}
+			handler.ServeHTTP(res, req)
+			return
+		}
+
+		method := req.Header.Get("Access-Control-Request-Method")
+		if !slices.Contains(policy.AllowedMethods, method) {
+			http.Error(res, "Method not allowed", http.StatusForbidden)
+			return
+		}
+		requested := req.Header.Get("Access-Control-Request-Headers")
+		if !allowsHeaders(policy, requested) {
+			http.Error(res, "Headers not allowed", http.StatusForbidden)
+			return
+		}
+
+		header.Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+		if requested != "" {
+			if slices.Contains(policy.AllowedHeaders, "*") {
+				header.Set("Access-Control-Allow-Headers", requested)
+			} else {
+				header.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+			}
+		}
+		if policy.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+		}
+		res.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowsOrigin reports whether origin matches one of the allowed origin patterns of policy.
+func allowsOrigin(policy *config.CORSPolicy, origin string) bool {
+	for _, pattern := range policy.AllowedOrigins {
+		if pattern == "*" {
+			return true
+		}
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(origin)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders reports whether every header of the comma-separated list requested is allowed by policy.
+func allowsHeaders(policy *config.CORSPolicy, requested string) bool {
+	if slices.Contains(policy.AllowedHeaders, "*") {
+		return true
+	}
+	for name := range strings.SplitSeq(requested, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.ContainsFunc(policy.AllowedHeaders, func(allowed string) bool { return strings.EqualFold(allowed, name) }) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"assetgoblin/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestCORS_Apply verifies preflight and actual requests are answered by the policy of their path.
+func TestCORS_Apply(t *testing.T) {
+	cors := CORS{
+		Config: &config.CORS{
+			Images: config.CORSPolicy{
+				AllowedOrigins:   []string{"https://*.example.com"},
+				AllowedMethods:   []string{"GET", "HEAD"},
+				AllowedHeaders:   []string{"X-Requested-With"},
+				ExposedHeaders:   []string{"ETag"},
+				AllowCredentials: true,
+				MaxAge:           10 * time.Minute,
+			},
+			Public: config.CORSPolicy{
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"GET"},
+				AllowedHeaders: []string{"*"},
+			},
+		},
+		ImagePath: "/img/",
+	}
+	var reached bool
+	handler := cors.Apply(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		reached = true
+		res.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		origin          string
+		requestMethod   string
+		requestHeaders  string
+		wantStatus      int
+		wantReached     bool
+		wantAllowOrigin string
+		wantHeaders     map[string]string
+	}{
+		{
+			name: "image request", method: http.MethodGet, path: "/img/thumb/a.jpg", origin: "https://editor.example.com",
+			wantStatus: http.StatusOK, wantReached: true, wantAllowOrigin: "https://editor.example.com",
+			wantHeaders: map[string]string{"Access-Control-Allow-Credentials": "true", "Access-Control-Expose-Headers": "ETag"},
+		},
+		{
+			name: "image preflight", method: http.MethodOptions, path: "/img/thumb/a.jpg", origin: "https://editor.example.com",
+			requestMethod: "GET", requestHeaders: "x-requested-with",
+			wantStatus: http.StatusNoContent, wantAllowOrigin: "https://editor.example.com",
+			wantHeaders: map[string]string{"Access-Control-Allow-Methods": "GET, HEAD", "Access-Control-Allow-Headers": "X-Requested-With", "Access-Control-Max-Age": "600"},
+		},
+		{
+			name: "image origin not allowed", method: http.MethodGet, path: "/img/thumb/a.jpg", origin: "https://example.org",
+			wantStatus: http.StatusOK, wantReached: true,
+		},
+		{
+			name: "image preflight origin not allowed", method: http.MethodOptions, path: "/img/thumb/a.jpg", origin: "https://example.org",
+			requestMethod: "GET", wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "image preflight method not allowed", method: http.MethodOptions, path: "/img/thumb/a.jpg", origin: "https://editor.example.com",
+			requestMethod: "DELETE", wantStatus: http.StatusForbidden, wantAllowOrigin: "https://editor.example.com",
+		},
+		{
+			name: "image preflight header not allowed", method: http.MethodOptions, path: "/img/thumb/a.jpg", origin: "https://editor.example.com",
+			requestMethod: "GET", requestHeaders: "Authorization", wantStatus: http.StatusForbidden, wantAllowOrigin: "https://editor.example.com",
+		},
+		{
+			name: "public request", method: http.MethodGet, path: "/app.css", origin: "https://example.org",
+			wantStatus: http.StatusOK, wantReached: true, wantAllowOrigin: "*",
+		},
+		{
+			name: "public preflight with any header", method: http.MethodOptions, path: "/app.css", origin: "https://example.org",
+			requestMethod: "GET", requestHeaders: "Authorization, X-Custom",
+			wantStatus: http.StatusNoContent, wantAllowOrigin: "*",
+			wantHeaders: map[string]string{"Access-Control-Allow-Headers": "Authorization, X-Custom", "Access-Control-Max-Age": ""},
+		},
+		{
+			name: "same-origin request", method: http.MethodGet, path: "/app.css",
+			wantStatus: http.StatusOK, wantReached: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = false
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			if tt.requestHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.requestHeaders)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus || reached != tt.wantReached {
+				t.Fatalf("status = %d, reached = %v; want %d, %v", rec.Code, reached, tt.wantStatus, tt.wantReached)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllowOrigin)
+			}
+			for name, want := range tt.wantHeaders {
+				if got := rec.Header().Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if rec.Header().Get("Vary") != "Origin" {
+				t.Errorf("Vary = %q, want Origin", rec.Header().Values("Vary"))
+			}
+		})
+	}
+}
+
+// TestCORS_Disabled verifies requests pass through untouched without allowed origins.
+func TestCORS_Disabled(t *testing.T) {
+	cors := CORS{Config: &config.CORS{}, ImagePath: "/img/"}
+	handler := cors.Apply(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/img/a.jpg", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || len(rec.Header()) != 0 {
+		t.Errorf("response = %d %v, want 200 without headers", rec.Code, rec.Header())
+	}
+}
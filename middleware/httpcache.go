@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"assetgoblin/config"
+	"assetgoblin/utils"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// HTTPCache is a middleware that applies the configured caching headers to responses.
+type HTTPCache struct {
+	Config *config.HTTPCache
+}
+
+// Apply returns a middleware handler that sets the error Cache-Control policy on error responses
+// without a Cache-Control header of their own, and removes Last-Modified headers if disabled.
+func (c *HTTPCache) Apply(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		handler.ServeHTTP(&cacheHeaderWriter{ResponseWriter: res, config: c.Config}, req)
+	})
+}
+
+// Static returns a middleware handler for files served from dir that sets the Cache-Control header
+// of the first matching public rule and a strong ETag for existing files.
+// Headers are only set for existing files, so error responses are left to Apply.
+// A Cache-Control header set by an outer handler, e.g. for hashed asset URLs, is kept.
+func (c *HTTPCache) Static(dir string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		rel := strings.TrimPrefix(path.Clean("/"+req.URL.Path), "/")
+		file := filepath.Join(dir, filepath.FromSlash(rel))
+
+		info, err := os.Stat(file)
+		if err == nil && info.IsDir() {
+			rel = path.Join(rel, "index.html")
+			file = filepath.Join(file, "index.html")
+			info, err = os.Stat(file)
+		}
+		if err != nil || !info.Mode().IsRegular() {
+			handler.ServeHTTP(res, req)
+			return
+		}
+
+		for _, rule := range c.Config.Public {
+			if res.Header().Get("Cache-Control") != "" {
+				break
+			}
+			if utils.MatchesGlob([]string{rule.Pattern}, rel) {
+				if rule.CacheControl != "" {
+					res.Header().Set("Cache-Control", rule.CacheControl)
+				}
+				break
+			}
+		}
+
+		if c.Config.ETag {
+			if etag, err := utils.FileETag(file, info); err == nil {
+				res.Header().Set("ETag", etag)
+			} else {
+				slog.Warn("Failed to compute ETag", "error", err)
+			}
+		}
+
+		handler.ServeHTTP(res, req)
+	})
+}
+
+// cacheHeaderWriter adjusts the caching headers right before the response header is written.
+type cacheHeaderWriter struct {
+	http.ResponseWriter
+	config      *config.HTTPCache
+	wroteHeader bool
+}
+
+// WriteHeader adjusts the caching headers for the status code and writes the response header.
+func (w *cacheHeaderWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		header := w.Header()
+		if !w.config.LastModified {
+			header.Del("Last-Modified")
+		}
+		if status >= http.StatusBadRequest && w.config.Errors != "" && header.Get("Cache-Control") == "" {
+			header.Set("Cache-Control", w.config.Errors)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write writes the response body, writing a 200 response header first if needed.
+func (w *cacheHeaderWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap returns the underlying response writer for http.ResponseController.
+func (w *cacheHeaderWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
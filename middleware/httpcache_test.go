@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"assetgoblin/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestHTTPCache_Static verifies public files get the matching Cache-Control rule, ETags and error policies.
+func TestHTTPCache_Static(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "assets"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	for _, name := range []string{"index.html", "assets/app.js", "robots.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	cfg := &config.HTTPCache{
+		ETag:   true,
+		Errors: "no-store",
+		Public: []config.CacheControlRule{
+			{Pattern: "*.html", CacheControl: "no-cache"},
+			{Pattern: "assets/*", CacheControl: "public, max-age=31536000, immutable"},
+		},
+	}
+	httpCache := HTTPCache{Config: cfg}
+	handler := httpCache.Apply(httpCache.Static(dir, http.FileServer(http.Dir(dir))))
+
+	tests := []struct {
+		name             string
+		path             string
+		ifNoneMatch      bool
+		wantStatus       int
+		wantCacheControl string
+		wantETag         bool
+	}{
+		{name: "directory index", path: "/", wantStatus: http.StatusOK, wantCacheControl: "no-cache", wantETag: true},
+		{name: "immutable asset", path: "/assets/app.js", wantStatus: http.StatusOK, wantCacheControl: "public, max-age=31536000, immutable", wantETag: true},
+		{name: "no matching rule", path: "/robots.txt", wantStatus: http.StatusOK, wantETag: true},
+		{name: "matching ETag", path: "/assets/app.js", ifNoneMatch: true, wantStatus: http.StatusNotModified, wantCacheControl: "public, max-age=31536000, immutable", wantETag: true},
+		{name: "missing file", path: "/assets/missing.js", wantStatus: http.StatusNotFound, wantCacheControl: "no-store"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.ifNoneMatch {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+				req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCacheControl)
+			}
+			if got := rec.Header().Get("ETag") != ""; got != tt.wantETag {
+				t.Errorf("ETag set = %v, want %v", got, tt.wantETag)
+			}
+		})
+	}
+}
+
+// TestHTTPCache_Apply verifies Last-Modified can be disabled and error policies don't override handlers.
+func TestHTTPCache_Apply(t *testing.T) {
+	tests := []struct {
+		name             string
+		lastModified     bool
+		status           int
+		cacheControl     string
+		wantLastModified bool
+		wantCacheControl string
+	}{
+		{name: "last modified enabled", lastModified: true, status: http.StatusOK, wantLastModified: true},
+		{name: "last modified disabled", status: http.StatusOK},
+		{name: "error policy", lastModified: true, status: http.StatusTooManyRequests, wantLastModified: true, wantCacheControl: "no-store"},
+		{name: "error with own policy", lastModified: true, status: http.StatusNotFound, cacheControl: "public, max-age=60", wantLastModified: true, wantCacheControl: "public, max-age=60"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpCache := HTTPCache{Config: &config.HTTPCache{LastModified: tt.lastModified, Errors: "no-store"}}
+			handler := httpCache.Apply(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+				res.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+				if tt.cacheControl != "" {
+					res.Header().Set("Cache-Control", tt.cacheControl)
+				}
+				res.WriteHeader(tt.status)
+			}))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if got := rec.Header().Get("Last-Modified") != ""; got != tt.wantLastModified {
+				t.Errorf("Last-Modified set = %v, want %v", got, tt.wantLastModified)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCacheControl)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"assetgoblin/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestMetrics verifies rate-limit rejections and signature failures are counted.
+func TestMetrics(t *testing.T) {
+	ok := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {})
+
+	limiter := NewRateLimit(&config.RateLimit{Limit: 1, Ttl: time.Minute})
+	handler := limiter.Limit(ok)
+	before := rateLimitRejections.Value()
+	for range 3 {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if got := rateLimitRejections.Value() - before; got != 2 {
+		t.Errorf("rate limit rejections = %v, want 2", got)
+	}
+
+	signkey := &Signkey{Secret: "secret"}
+	handler = signkey.Verify(ok)
+	missing, invalid := signatureFailures.Value("missing"), signatureFailures.Value("invalid")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a.css", nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a.css?token=bad", nil))
+	if got := signatureFailures.Value("missing") - missing; got != 1 {
+		t.Errorf("missing signature failures = %v, want 1", got)
+	}
+	if got := signatureFailures.Value("invalid") - invalid; got != 1 {
+		t.Errorf("invalid signature failures = %v, want 1", got)
+	}
+}
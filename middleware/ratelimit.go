@@ -5,12 +5,17 @@ package middleware
 
 import (
 	"assetgoblin/config"
+	"assetgoblin/metrics"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 )
 
+// rateLimitRejections counts the requests rejected by the rate limiter.
+var rateLimitRejections = metrics.NewCounterVec("assetgoblin_rate_limit_rejections_total",
+	"Requests rejected by the rate limiter.")
+
 // RateLimit is a middleware that limits the number of requests from a single IP address.
 // It uses a map to track requests and their timestamps, with a mutex for thread safety.
 type RateLimit struct {
@@ -53,6 +58,7 @@ func (r *RateLimit) Limit(handler http.Handler) http.Handler {
 		if client, found := r.requests[ip]; found {
 			if time.Since(client.lastRequest) < r.Config.Ttl {
 				if client.count >= r.Config.Limit {
+					rateLimitRejections.Inc()
 					http.Error(res, "Rate limit exceeded", http.StatusTooManyRequests)
 					return
 				}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"assetgoblin/config"
+	"net/http"
+)
+
+// SecurityHeaders is a middleware that sends the configured security headers with every response.
+type SecurityHeaders struct {
+	Config *config.Security
+}
+
+// Apply returns a middleware handler that sets the non-empty security headers before the request is handled,
+// so handlers can still override them for individual responses.
+func (s *SecurityHeaders) Apply(handler http.Handler) http.Handler {
+	headers := map[string]string{
+		"Content-Security-Policy":      s.Config.ContentSecurityPolicy,
+		"X-Content-Type-Options":       s.Config.ContentTypeOptions,
+		"Cross-Origin-Resource-Policy": s.Config.CrossOriginResourcePolicy,
+		"Referrer-Policy":              s.Config.ReferrerPolicy,
+	}
+	for name, value := range headers {
+		if value == "" {
+			delete(headers, name)
+		}
+	}
+
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		for name, value := range headers {
+			res.Header().Set(name, value)
+		}
+		handler.ServeHTTP(res, req)
+	})
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"assetgoblin/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSecurityHeaders_Apply verifies configured headers are sent, also with errors, and empty values are omitted.
+func TestSecurityHeaders_Apply(t *testing.T) {
+	security := SecurityHeaders{Config: &config.Security{
+		ContentSecurityPolicy: "default-src 'none'",
+		ContentTypeOptions:    "nosniff",
+		ReferrerPolicy:        "no-referrer",
+	}}
+	handler := security.Apply(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		http.NotFound(res, req)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing.txt", nil))
+
+	want := map[string]string{
+		"Content-Security-Policy":      "default-src 'none'",
+		"X-Content-Type-Options":       "nosniff",
+		"Referrer-Policy":              "no-referrer",
+		"Cross-Origin-Resource-Policy": "",
+	}
+	for name, value := range want {
+		if got := rec.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if _, ok := rec.Header()["Cross-Origin-Resource-Policy"]; ok {
+		t.Error("empty Cross-Origin-Resource-Policy was sent")
+	}
+}
@@ -4,38 +4,106 @@
 package middleware
 
 import (
+	"assetgoblin/metrics"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
 	"net/http"
+	"strconv"
+	"time"
 )
 
+// contextKey is the type of context keys set by the middleware package.
+type contextKey string
+
+// verifiedKey marks requests whose signature token was verified.
+const verifiedKey contextKey = "signkey.verified"
+
+// tokenKey stores the signature token verified by Signkey.
+const tokenKey contextKey = "signkey.token"
+
+// signatureFailures counts the requests rejected by Signkey, by reason (missing, invalid or expired token).
+var signatureFailures = metrics.NewCounterVec("assetgoblin_signature_failures_total",
+	"Requests rejected for a missing, invalid or expired signature token.", "reason")
+
 // Signkey is a middleware that verifies request signatures using HMAC-SHA256.
 // It requires a secret key to validate tokens provided in request query parameters.
+// Tokens sign the path and the expiry time passed in the expires query parameter.
 type Signkey struct {
-	Secret string // Secret is the key used for HMAC signature verification
+	Secret       string        // Secret is the key used for HMAC signature verification
+	ClockSkew    time.Duration // ClockSkew is how long tokens are still accepted after their expiry time
+	LegacyTokens bool          // LegacyTokens accepts tokens without expiry time that sign only the path
 }
 
 // Verify returns a middleware handler that checks if the request has a valid
 // signature token. If the token is valid, the request is passed to the next handler.
-// If the token is invalid, a 401 Unauthorized response is returned.
+// If the token is invalid or expired, a 401 Unauthorized response is returned.
+// Verified requests are marked in their context, see IsVerified.
 func (s *Signkey) Verify(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-		if !s.isValidToken(req.URL.Path, req.URL.Query().Get("token")) {
+		query := req.URL.Query()
+		token := query.Get("token")
+
+		var expires int64
+		valid := false
+		if value := query.Get("expires"); value != "" {
+			var err error
+			expires, err = strconv.ParseInt(value, 10, 64)
+			valid = err == nil && expires > 0 && s.isValidToken(req.URL.Path, expires, token)
+		} else if s.LegacyTokens {
+			valid = s.isValidToken(req.URL.Path, 0, token)
+		}
+
+		if !valid {
+			if token == "" {
+				signatureFailures.Inc("missing")
+			} else {
+				signatureFailures.Inc("invalid")
+			}
 			http.Error(res, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		if expires > 0 && time.Now().After(time.Unix(expires, 0).Add(s.ClockSkew)) {
+			signatureFailures.Inc("expired")
+			http.Error(res, "Token expired", http.StatusUnauthorized)
+			return
+		}
 
-		handler.ServeHTTP(res, req)
+		ctx := context.WithValue(req.Context(), verifiedKey, true)
+		ctx = context.WithValue(ctx, tokenKey, token)
+		handler.ServeHTTP(res, req.WithContext(ctx))
 	})
 }
 
-// isValidToken checks if the provided token is valid for the given path.
-// It computes an HMAC-SHA256 hash of the path using the secret key and compares
-// it with the provided token. Returns true if the token is valid, false otherwise.
-func (s *Signkey) isValidToken(path, token string) bool {
+// IsVerified reports whether the request passed signature verification by Signkey.
+func IsVerified(req *http.Request) bool {
+	verified, _ := req.Context().Value(verifiedKey).(bool)
+	return verified
+}
+
+// HasValidToken reports whether the request itself carries the signature token verified by Signkey.
+// Unlike IsVerified, it is false for requests derived from a verified request without its token.
+func HasValidToken(req *http.Request) bool {
+	token, _ := req.Context().Value(tokenKey).(string)
+	return token != "" && req.URL.Query().Get("token") == token
+}
+
+// Token returns the signature token of path expiring at the Unix time expires.
+// It is the hex-encoded HMAC-SHA256 hash of the path followed by "?expires=" and the expiry time.
+// An expiry time of 0 returns a legacy token of the path only, accepted only with LegacyTokens.
+func (s *Signkey) Token(path string, expires int64) string {
 	hasher := hmac.New(sha256.New, []byte(s.Secret))
 	hasher.Write([]byte(path))
-	expectedToken := hex.EncodeToString(hasher.Sum(nil))
-	return hmac.Equal([]byte(token), []byte(expectedToken))
+	if expires > 0 {
+		hasher.Write([]byte("?expires=" + strconv.FormatInt(expires, 10)))
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// isValidToken checks if the provided token is valid for the given path and expiry time.
+// It computes the expected token using the secret key and compares it with the provided token
+// in constant time. Returns true if the token is valid, false otherwise.
+func (s *Signkey) isValidToken(path string, expires int64, token string) bool {
+	return hmac.Equal([]byte(token), []byte(s.Token(path, expires)))
 }
@@ -4,65 +4,110 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
-// TestSignkey_Verify validates request authorization for valid and invalid tokens.
+// TestSignkey_Verify validates request authorization for valid, invalid, expired and legacy tokens.
 func TestSignkey_Verify(t *testing.T) {
+	future := time.Now().Add(time.Hour).Unix()
+	past := time.Now().Add(-time.Minute).Unix()
+	recent := time.Now().Add(-10 * time.Second).Unix()
+
 	tests := []struct {
-		name       string
-		secret     string
-		path       string
-		token      string
-		wantStatus int
+		name         string
+		legacyTokens bool
+		path         string
+		query        string
+		wantStatus   int
 	}{
 		{
 			name:       "valid token",
-			secret:     "secret",
 			path:       "/test-path",
-			token:      generateToken("secret", "/test-path"),
+			query:      expiringQuery("secret", "/test-path", future),
 			wantStatus: http.StatusOK,
 		},
 		{
 			name:       "invalid token",
-			secret:     "secret",
 			path:       "/test-path",
-			token:      "invalid-token",
+			query:      fmt.Sprintf("expires=%d&token=invalid-token", future),
 			wantStatus: http.StatusUnauthorized,
 		},
 		{
 			name:       "empty token",
-			secret:     "secret",
 			path:       "/test-path",
-			token:      "",
+			query:      "token=",
 			wantStatus: http.StatusUnauthorized,
 		},
 		{
 			name:       "wrong secret",
-			secret:     "secret",
 			path:       "/test-path",
-			token:      generateToken("wrong-secret", "/test-path"),
+			query:      expiringQuery("wrong-secret", "/test-path", future),
 			wantStatus: http.StatusUnauthorized,
 		},
 		{
 			name:       "wrong path",
-			secret:     "secret",
 			path:       "/test-path",
-			token:      generateToken("secret", "/wrong-path"),
+			query:      expiringQuery("secret", "/wrong-path", future),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "extended expiry",
+			path:       "/test-path",
+			query:      fmt.Sprintf("expires=%d&token=%s", future+3600, generateToken("secret", "/test-path", future)),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "expired",
+			path:       "/test-path",
+			query:      expiringQuery("secret", "/test-path", past),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "expired within clock skew",
+			path:       "/test-path",
+			query:      expiringQuery("secret", "/test-path", recent),
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "invalid expiry",
+			path:       "/test-path",
+			query:      "expires=soon&token=" + generateToken("secret", "/test-path", 0),
 			wantStatus: http.StatusUnauthorized,
 		},
+		{
+			name:       "legacy token",
+			path:       "/test-path",
+			query:      "token=" + generateToken("secret", "/test-path", 0),
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:         "legacy token enabled",
+			legacyTokens: true,
+			path:         "/test-path",
+			query:        "token=" + generateToken("secret", "/test-path", 0),
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "expired with legacy tokens enabled",
+			legacyTokens: true,
+			path:         "/test-path",
+			query:        expiringQuery("secret", "/test-path", past),
+			wantStatus:   http.StatusUnauthorized,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			signkey := Signkey{Secret: tt.secret}
+			signkey := Signkey{Secret: "secret", ClockSkew: 30 * time.Second, LegacyTokens: tt.legacyTokens}
 			handler := signkey.Verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(http.StatusOK)
 			}))
 
-			req := httptest.NewRequest(http.MethodGet, tt.path+"?token="+tt.token, nil)
+			req := httptest.NewRequest(http.MethodGet, tt.path+"?"+tt.query, nil)
 			rr := httptest.NewRecorder()
 			handler.ServeHTTP(rr, req)
 
@@ -73,9 +118,69 @@ func TestSignkey_Verify(t *testing.T) {
 	}
 }
 
+// TestSignkey_Token verifies generated tokens match the documented HMAC of path and expiry time.
+func TestSignkey_Token(t *testing.T) {
+	signkey := Signkey{Secret: "secret"}
+	if got, want := signkey.Token("/img/a.jpg", 1700000000), generateToken("secret", "/img/a.jpg", 1700000000); got != want {
+		t.Errorf("Token() = %q, want %q", got, want)
+	}
+	if got, want := signkey.Token("/img/a.jpg", 0), generateToken("secret", "/img/a.jpg", 0); got != want {
+		t.Errorf("Token() legacy = %q, want %q", got, want)
+	}
+}
+
+// TestIsVerified verifies that only requests passing Verify are marked as verified.
+func TestIsVerified(t *testing.T) {
+	if IsVerified(httptest.NewRequest(http.MethodGet, "/test-path", nil)) {
+		t.Errorf("IsVerified() = true for a request that did not pass Verify")
+	}
+
+	verified := false
+	signkey := Signkey{Secret: "secret"}
+	handler := signkey.Verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verified = IsVerified(r)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test-path?"+expiringQuery("secret", "/test-path", time.Now().Add(time.Hour).Unix()), nil))
+
+	if !verified {
+		t.Errorf("IsVerified() = false for a verified request")
+	}
+}
+
 // generateToken builds a deterministic HMAC token used by signkey tests.
-func generateToken(secret, path string) string {
+// An expiry time of 0 builds a legacy token of the path only.
+func generateToken(secret, path string, expires int64) string {
 	hasher := hmac.New(sha256.New, []byte(secret))
 	hasher.Write([]byte(path))
+	if expires > 0 {
+		hasher.Write([]byte(fmt.Sprintf("?expires=%d", expires)))
+	}
 	return hex.EncodeToString(hasher.Sum(nil))
 }
+
+// expiringQuery builds the query string of a URL signed until the Unix time expires.
+func expiringQuery(secret, path string, expires int64) string {
+	return fmt.Sprintf("expires=%d&token=%s", expires, generateToken(secret, path, expires))
+}
+
+// TestHasValidToken verifies only requests carrying the verified token are reported as signed.
+func TestHasValidToken(t *testing.T) {
+	var verifiedReq *http.Request
+	signkey := Signkey{Secret: "secret"}
+	handler := signkey.Verify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		verifiedReq = r
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/test-path?"+expiringQuery("secret", "/test-path", time.Now().Add(time.Hour).Unix()), nil))
+
+	if verifiedReq == nil || !HasValidToken(verifiedReq) {
+		t.Fatalf("HasValidToken() = false for a verified request")
+	}
+	derived := verifiedReq.Clone(verifiedReq.Context())
+	derived.URL.RawQuery = ""
+	if HasValidToken(derived) {
+		t.Errorf("HasValidToken() = true for a request without the verified token")
+	}
+	if HasValidToken(httptest.NewRequest(http.MethodGet, "/test-path?token=abc", nil)) {
+		t.Errorf("HasValidToken() = true for a request that did not pass Verify")
+	}
+}
@@ -2,24 +2,32 @@ package main
 
 import (
 	"assetgoblin/image"
+	"assetgoblin/metrics"
 	"assetgoblin/middleware"
+	"assetgoblin/server"
+	"assetgoblin/tracing"
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
 	"time"
 )
 
 // serve starts the HTTP server with the configured handlers and middleware.
-// It loads the configuration, sets up routes for serving images and static files,
-// and applies middleware for security and rate limiting if configured.
+// It loads the configuration, sets up routes for images, static files, admin and health endpoints,
+// applies the configured middleware, and runs until SIGINT or SIGTERM, see shutdown.
 func serve() {
 	if err := conf.Load(); err != nil {
 		slog.Error("Failed to load config", "error", err)
 		os.Exit(1)
 	}
 
-	if conf.Port == "" {
+	if conf.Port == "" && conf.Listen.Socket == "" {
 		slog.Error("Invalid port", "port", conf.Port)
 		os.Exit(1)
 	}
@@ -28,38 +36,263 @@ func serve() {
 
 	mux := http.NewServeMux()
 
-	if len(conf.Image.Formats) > 0 && len(conf.Image.Presets) > 0 {
-		imageService := image.Service{Config: &conf.Image}
+	imageService := &image.Service{Config: &conf.Image, HTTPCache: &conf.HTTPCache, PublicDir: conf.PublicDir}
+	imagesEnabled := len(conf.Image.Formats) > 0 && len(conf.Image.Presets) > 0
+	if imagesEnabled {
 		mux.HandleFunc(conf.Image.Path, imageService.Serve)
 	} else {
 		slog.Warn("Images are served as static files due to missing config")
 	}
 
-	mux.Handle("/", http.FileServer(http.Dir(filepath.Join(wd, conf.PublicDir))))
+	if conf.Image.GC.Interval > 0 {
+		go collectGarbage(imageService, conf.Image.GC.Interval)
+	}
+
+	httpCacheMiddleware := middleware.HTTPCache{Config: &conf.HTTPCache}
+	publicDir := filepath.Join(wd, conf.PublicDir)
+	staticService := newStaticService(publicDir)
+	fileServer := staticService.Compress(http.FileServer(http.Dir(publicDir)))
+	mux.Handle("/", staticService.Protect(staticService.Resolve(httpCacheMiddleware.Static(publicDir, fileServer))))
 
 	var handler http.Handler = mux
 
 	if conf.Secret != "" {
-		signkeyMiddleware := middleware.Signkey{Secret: conf.Secret}
+		signkeyMiddleware := middleware.Signkey{
+			Secret:       conf.Secret,
+			ClockSkew:    conf.Signing.ClockSkew,
+			LegacyTokens: conf.Signing.LegacyTokens,
+		}
 		handler = signkeyMiddleware.Verify(handler)
 	}
 
+	corsMiddleware := middleware.CORS{Config: &conf.CORS}
+	if imagesEnabled {
+		corsMiddleware.ImagePath = conf.Image.Path
+	}
+	handler = corsMiddleware.Apply(handler)
+
+	adminMiddleware := middleware.AdminToken{Token: conf.Admin.Token}
+	if conf.Admin.Token != "" {
+		adminMux := http.NewServeMux()
+		adminMux.Handle(conf.Admin.Path+"cache/purge", adminMiddleware.Verify(http.HandlerFunc(imageService.ServePurge)))
+		adminMux.Handle("/", handler)
+		handler = adminMux
+	}
+
 	if conf.RateLimit.Limit > 0 {
 		ratelimitMiddleware := middleware.NewRateLimit(&conf.RateLimit)
 		handler = ratelimitMiddleware.Limit(handler)
 	}
 
+	health := server.Health{Checks: readinessChecks(imageService, publicDir, imagesEnabled), ShowDetails: adminMiddleware.Authorized}
+	handler = health.Handler(handler)
+
+	if conf.Metrics.Path != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle(conf.Metrics.Path, metrics.Default)
+		metricsMux.Handle("/", handler)
+		handler = metricsMux
+
+		if imagesEnabled {
+			metrics.NewGaugeFunc("assetgoblin_image_cache_bytes", "Total size of the image cache directory in bytes.",
+				func() float64 { return float64(imageService.CacheBytes()) })
+		}
+	}
+
+	handler = httpCacheMiddleware.Apply(handler)
+	securityMiddleware := middleware.SecurityHeaders{Config: &conf.Security}
+	handler = securityMiddleware.Apply(handler)
+	handler = metrics.Instrument(handler, func(req *http.Request) string { return route(req, imagesEnabled) })
+
+	if conf.AccessLog.Format != "off" {
+		accessLog, err := middleware.NewAccessLog(&conf.AccessLog)
+		if err != nil {
+			slog.Error("Failed to open access log", "error", err)
+			os.Exit(1)
+		}
+		defer accessLog.Close()
+		go reopenOnHangup(accessLog)
+		handler = accessLog.Log(handler)
+	}
+
+	var tracer *tracing.Tracer
+	if conf.Tracing.Endpoint != "" {
+		tracer = tracing.NewTracer(&conf.Tracing)
+		handler = tracer.Middleware(handler)
+	}
+
 	srv := &http.Server{
-		Addr:         ":" + conf.Port,
 		Handler:      handler,
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	servers := []*http.Server{srv}
+
+	redirectPort := ""
+	if conf.TLS.Enabled() {
+		reloader, err := server.NewCertReloader(conf.TLS.CertFile, conf.TLS.KeyFile)
+		if err != nil {
+			slog.Error("Failed to load TLS certificate", "error", err)
+			os.Exit(1)
+		}
+		srv.TLSConfig = server.TLSConfig(&conf.TLS, reloader)
+		redirectPort = conf.TLS.RedirectPort
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	slog.Info("Starting server", "port", conf.Port)
-	if err := srv.ListenAndServe(); err != nil {
+	listeners, err := server.Listen(&conf.Listen, conf.Port, redirectPort)
+	if err != nil {
 		slog.Error("Server failed to start", "error", err)
 		os.Exit(1)
 	}
+
+	serveErr := make(chan error, len(listeners.Main)+len(listeners.Redirect))
+	for _, ln := range listeners.Main {
+		slog.Info("Starting server", "addr", ln.Addr().String(), "tls", srv.TLSConfig != nil)
+		go func() {
+			if srv.TLSConfig != nil {
+				serveErr <- srv.ServeTLS(ln, "", "")
+			} else {
+				serveErr <- srv.Serve(ln)
+			}
+		}()
+	}
+	if conf.TLS.Enabled() && len(listeners.Redirect) > 0 {
+		redirect := &http.Server{
+			Handler:      server.RedirectHTTPS(conf.Port),
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+		servers = append(servers, redirect)
+		for _, ln := range listeners.Redirect {
+			slog.Info("Starting HTTPS redirect", "addr", ln.Addr().String())
+			go func() { serveErr <- redirect.Serve(ln) }()
+		}
+	} else {
+		for _, ln := range listeners.Redirect {
+			_ = ln.Close()
+		}
+	}
+
+	if err = server.Notify("READY=1"); err != nil {
+		slog.Warn("Failed to notify systemd", "error", err)
+	}
+	watchdogCtx, stopWatchdog := context.WithCancel(context.Background())
+	defer stopWatchdog()
+	go server.Watchdog(watchdogCtx)
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Server failed", "error", err)
+			os.Exit(1)
+		}
+	case <-ctx.Done():
+		stop()
+		shutdown(servers, imageService, tracer, conf.ShutdownTimeout)
+	}
+}
+
+// shutdown stops accepting connections and waits up to timeout for in-flight requests.
+// Conversions still running after the deadline are killed and their partial outputs removed.
+// Finally, the remaining spans are exported if tracing is enabled.
+func shutdown(servers []*http.Server, imageService *image.Service, tracer *tracing.Tracer, timeout time.Duration) {
+	slog.Info("Shutting down server", "timeout", timeout)
+	if err := server.Notify("STOPPING=1"); err != nil {
+		slog.Warn("Failed to notify systemd", "error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Warn("Requests still in flight after shutdown timeout", "error", err)
+		}
+	}
+	imageService.Shutdown()
+
+	if tracer != nil {
+		exportCtx, cancelExport := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelExport()
+		if err := tracer.Shutdown(exportCtx); err != nil {
+			slog.Warn("Failed to export remaining spans", "error", err)
+		}
+	}
+
+	slog.Info("Server stopped")
+}
+
+// reopenOnHangup reopens the access log file on SIGHUP, e.g. after logrotate moved it.
+func reopenOnHangup(accessLog *middleware.AccessLog) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	for range hangup {
+		if err := accessLog.Reopen(); err != nil {
+			slog.Error("Failed to reopen access log", "error", err)
+		}
+	}
+}
+
+// route names the route of a request for the request metrics.
+func route(req *http.Request, imagesEnabled bool) string {
+	path := req.URL.Path
+	switch {
+	case path == server.LivenessPath || path == server.ReadinessPath:
+		return "health"
+	case conf.Metrics.Path != "" && path == conf.Metrics.Path:
+		return "metrics"
+	case conf.Admin.Token != "" && strings.HasPrefix(path, conf.Admin.Path):
+		return "admin"
+	case imagesEnabled && strings.HasPrefix(path, conf.Image.Path):
+		return "image"
+	default:
+		return "static"
+	}
+}
+
+// readinessChecks returns the checks of the readiness endpoint. Image checks are included
+// only if images are served; converters are checked at most once a minute.
+func readinessChecks(imageService *image.Service, publicDir string, imagesEnabled bool) []*server.Check {
+	checks := []*server.Check{
+		{Name: "config", Run: func(context.Context) (string, error) {
+			if conf.LoadedFromGob {
+				return conf.UsedConfigFile + " (gob)", nil
+			}
+			return conf.UsedConfigFile, nil
+		}},
+		{Name: "public_dir", Run: server.CheckReadableDir(publicDir)},
+	}
+	if imagesEnabled {
+		checks = append(checks,
+			&server.Check{Name: "converters", Interval: time.Minute, Run: image.CheckConverters},
+			&server.Check{Name: "image_directory", Run: server.CheckReadableDir(conf.Image.Directory)},
+			&server.Check{Name: "image_cache_dir", Run: func(context.Context) (string, error) {
+				return conf.Image.CacheDir, imageService.CheckCacheDir()
+			}},
+		)
+	}
+	return checks
+}
+
+// collectGarbage periodically removes cached derivatives that can no longer be served.
+func collectGarbage(imageService *image.Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		result, err := imageService.CollectGarbage(false)
+		if err != nil {
+			slog.Error("Failed to collect garbage", "error", err)
+			continue
+		}
+		if result.Count > 0 {
+			slog.Info("Collected garbage", "files", result.Count, "bytes", result.Bytes)
+		}
+	}
 }
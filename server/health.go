@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Paths of the liveness and readiness endpoints.
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// Status values of checks and reports.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Check is a readiness check. Run returns a detail shown in the report or an error if the check fails.
+// Results are reused for Interval, so expensive checks do not run on every probe.
+type Check struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) (string, error)
+
+	mu        sync.Mutex
+	last      CheckResult
+	checkedAt time.Time
+}
+
+// CheckResult is the outcome of a check in the readiness report.
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report is the JSON body of the health endpoints.
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// Health serves the liveness and readiness endpoints.
+type Health struct {
+	Checks      []*Check
+	Timeout     time.Duration                // Timeout limits the duration of each check, 5s if 0
+	ShowDetails func(req *http.Request) bool // ShowDetails allows the details of the checks in the report, never if nil
+}
+
+// Handler returns a handler serving the health endpoints and passing other requests to next.
+// It must wrap the signature and rate limit middleware, so probes are never rejected by them.
+func (h *Health) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case LivenessPath:
+			h.Live(res, req)
+		case ReadinessPath:
+			h.Ready(res, req)
+		default:
+			next.ServeHTTP(res, req)
+		}
+	})
+}
+
+// Live reports that the process is alive and able to serve requests.
+func (h *Health) Live(res http.ResponseWriter, req *http.Request) {
+	writeReport(res, req, Report{Status: StatusOK})
+}
+
+// Ready runs the checks concurrently and reports each result. The status is 503 if any check fails.
+// Details, which may contain paths and versions, are only reported to requests allowed by ShowDetails.
+func (h *Health) Ready(res http.ResponseWriter, req *http.Request) {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: make([]CheckResult, len(h.Checks))}
+	var wg sync.WaitGroup
+	for i, check := range h.Checks {
+		wg.Go(func() {
+			report.Checks[i] = check.result(ctx)
+		})
+	}
+	wg.Wait()
+
+	showDetails := h.ShowDetails != nil && h.ShowDetails(req)
+	for i, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+		if !showDetails {
+			report.Checks[i].Detail = ""
+		}
+	}
+	writeReport(res, req, report)
+}
+
+// result runs the check unless its last result is recent enough.
+func (c *Check) result(ctx context.Context) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.Interval {
+		return c.last
+	}
+
+	result := CheckResult{Name: c.Name, Status: StatusOK}
+	detail, err := c.Run(ctx)
+	if err != nil {
+		result.Status = StatusFail
+		detail = err.Error()
+	}
+	result.Detail = detail
+
+	c.last = result
+	c.checkedAt = time.Now()
+	return result
+}
+
+// writeReport writes the report as JSON, with status 503 unless it is ok.
+func writeReport(res http.ResponseWriter, req *http.Request, report Report) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		res.Header().Set("Allow", "GET, HEAD")
+		http.Error(res, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Cache-Control", "no-store")
+	if report.Status == StatusOK {
+		res.WriteHeader(http.StatusOK)
+	} else {
+		res.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if req.Method == http.MethodHead {
+		return
+	}
+	_ = json.NewEncoder(res).Encode(report)
+}
+
+// CheckReadableDir returns a check function verifying that dir is a readable directory.
+func CheckReadableDir(dir string) func(context.Context) (string, error) {
+	return func(context.Context) (string, error) {
+		file, err := os.Open(dir)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+
+		if _, err = file.Readdirnames(1); err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		return dir, nil
+	}
+}
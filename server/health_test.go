@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestHealth_Handler verifies the health endpoints report the checks and pass other requests on.
+func TestHealth_Handler(t *testing.T) {
+	failing := false
+	runs := 0
+	health := &Health{ShowDetails: func(req *http.Request) bool { return req.Header.Get("Authorization") == "Bearer admin" }, Checks: []*Check{
+		{Name: "static", Run: func(context.Context) (string, error) { return "fine", nil }},
+		{Name: "toggled", Interval: time.Hour, Run: func(context.Context) (string, error) {
+			runs++
+			if failing {
+				return "", errors.New("broken")
+			}
+			return "", nil
+		}},
+	}}
+	next := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusTeapot)
+	})
+	handler := health.Handler(next)
+
+	get := func(path string) (int, Report) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer admin")
+		handler.ServeHTTP(rec, req)
+		var report Report
+		if rec.Code != http.StatusTeapot {
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+			}
+			if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", cc)
+			}
+		}
+		return rec.Code, report
+	}
+
+	if status, report := get(LivenessPath); status != http.StatusOK || report.Status != StatusOK {
+		t.Errorf("liveness = %d %+v, want 200 ok", status, report)
+	}
+
+	status, report := get(ReadinessPath)
+	if status != http.StatusOK || report.Status != StatusOK || len(report.Checks) != 2 {
+		t.Fatalf("readiness = %d %+v, want 200 ok with 2 checks", status, report)
+	}
+	if report.Checks[0] != (CheckResult{Name: "static", Status: StatusOK, Detail: "fine"}) {
+		t.Errorf("checks[0] = %+v, want static ok", report.Checks[0])
+	}
+
+	failing = true
+	if status, _ = get(ReadinessPath); status != http.StatusOK || runs != 1 {
+		t.Errorf("readiness within interval = %d after %d runs, want cached 200 after 1 run", status, runs)
+	}
+	health.Checks[1].checkedAt = time.Time{}
+	status, report = get(ReadinessPath)
+	if status != http.StatusServiceUnavailable || report.Status != StatusFail {
+		t.Errorf("readiness with failing check = %d %+v, want 503 fail", status, report)
+	}
+	if got := report.Checks[1]; got.Status != StatusFail || got.Detail != "broken" {
+		t.Errorf("checks[1] = %+v, want fail with detail", got)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, ReadinessPath, nil))
+	var anonymous Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &anonymous); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	for _, check := range anonymous.Checks {
+		if check.Detail != "" {
+			t.Errorf("unauthorized readiness check %s detail = %q, want hidden", check.Name, check.Detail)
+		}
+	}
+	if anonymous.Status != StatusFail || len(anonymous.Checks) != 2 {
+		t.Errorf("unauthorized readiness = %+v, want fail with 2 checks", anonymous)
+	}
+
+	if status, _ = get("/img/photo.jpg"); status != http.StatusTeapot {
+		t.Errorf("other path = %d, want passed to next handler", status)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, LivenessPath, nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+// TestCheckReadableDir verifies directories pass and missing paths or files fail.
+func TestCheckReadableDir(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: dir},
+		{path: filepath.Join(dir, "missing"), wantErr: true},
+		{path: file, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.path), func(t *testing.T) {
+			if _, err := CheckReadableDir(tt.path)(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("CheckReadableDir(%q) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"assetgoblin/config"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation.
+const listenFDsStart = 3
+
+// redirectName is the systemd FileDescriptorName of sockets for the HTTPS redirect.
+const redirectName = "redirect"
+
+// Listeners contains the listeners of the server and of the HTTPS redirect.
+type Listeners struct {
+	Main     []net.Listener
+	Redirect []net.Listener
+}
+
+// Close closes all listeners.
+func (l Listeners) Close() {
+	for _, ln := range append(l.Main, l.Redirect...) {
+		_ = ln.Close()
+	}
+}
+
+// Listen opens the listeners of the server. Sockets passed by systemd socket activation are used
+// if present; sockets named "redirect" serve the HTTPS redirect and all others the server.
+// Otherwise, the server listens on the configured Unix socket or the TCP port. The redirect listens
+// on redirectPort unless systemd passed a redirect socket, and is disabled if redirectPort is empty.
+func Listen(conf *config.Listen, port, redirectPort string) (Listeners, error) {
+	var l Listeners
+
+	activated, err := systemdListeners()
+	if err != nil {
+		return l, err
+	}
+	for name, lns := range activated {
+		if name == redirectName {
+			l.Redirect = append(l.Redirect, lns...)
+		} else {
+			l.Main = append(l.Main, lns...)
+		}
+	}
+
+	if len(l.Main) == 0 {
+		var ln net.Listener
+		if conf.Socket != "" {
+			ln, err = listenUnix(conf)
+		} else {
+			ln, err = net.Listen("tcp", ":"+port)
+		}
+		if err != nil {
+			l.Close()
+			return Listeners{}, err
+		}
+		l.Main = append(l.Main, ln)
+	}
+
+	if redirectPort != "" && len(l.Redirect) == 0 {
+		ln, err := net.Listen("tcp", ":"+redirectPort)
+		if err != nil {
+			l.Close()
+			return Listeners{}, err
+		}
+		l.Redirect = append(l.Redirect, ln)
+	}
+
+	return l, nil
+}
+
+// listenUnix listens on the configured Unix socket, replacing a stale socket file left behind
+// by a previous process, and applies the configured permissions.
+func listenUnix(conf *config.Listen) (net.Listener, error) {
+	mode, err := conf.Mode()
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Lstat(conf.Socket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", conf.Socket)
+		}
+		if conn, err := net.Dial("unix", conf.Socket); err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", conf.Socket)
+		}
+		if err = os.Remove(conf.Socket); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", conf.Socket)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(conf.Socket, mode); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// systemdListeners returns the sockets passed by systemd socket activation, grouped by their
+// FileDescriptorName. The activation variables are unset, so child processes do not inherit them.
+func systemdListeners() (map[string][]net.Listener, error) {
+	count, names, err := parseListenEnv(os.Getenv, os.Getpid())
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+	if err != nil || count == 0 {
+		return nil, err
+	}
+
+	files := make([]*os.File, count)
+	for i := range files {
+		files[i] = os.NewFile(uintptr(listenFDsStart+i), names[i])
+	}
+	return fileListeners(files, names)
+}
+
+// parseListenEnv returns the number and names of the sockets passed to the process with pid.
+// Unnamed sockets get the name "unknown", as with sd_listen_fds_with_names.
+func parseListenEnv(getenv func(string) string, pid int) (int, []string, error) {
+	if getenv("LISTEN_PID") == "" || getenv("LISTEN_FDS") == "" {
+		return 0, nil, nil
+	}
+	if listenPID, err := strconv.Atoi(getenv("LISTEN_PID")); err != nil || listenPID != pid {
+		return 0, nil, nil
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count < 0 {
+		return 0, nil, fmt.Errorf("invalid LISTEN_FDS %q", getenv("LISTEN_FDS"))
+	}
+
+	names := make([]string, count)
+	given := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+	for i := range names {
+		names[i] = "unknown"
+		if i < len(given) && given[i] != "" {
+			names[i] = given[i]
+		}
+	}
+	return count, names, nil
+}
+
+// fileListeners converts the passed socket files into listeners and closes the files.
+func fileListeners(files []*os.File, names []string) (map[string][]net.Listener, error) {
+	listeners := map[string][]net.Listener{}
+	var errs []error
+	for i, file := range files {
+		ln, err := net.FileListener(file)
+		_ = file.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("socket %d (%s): %w", listenFDsStart+i, names[i], err))
+			continue
+		}
+		listeners[names[i]] = append(listeners[names[i]], ln)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		for _, lns := range listeners {
+			for _, ln := range lns {
+				_ = ln.Close()
+			}
+		}
+		return nil, err
+	}
+	return listeners, nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"assetgoblin/config"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// TestParseListenEnv verifies socket activation variables are only used by the target process.
+func TestParseListenEnv(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       map[string]string
+		wantCount int
+		wantNames []string
+		wantErr   bool
+	}{
+		{name: "not activated", env: map[string]string{}},
+		{name: "other process", env: map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"}},
+		{name: "named sockets", env: map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "2", "LISTEN_FDNAMES": "http:redirect"}, wantCount: 2, wantNames: []string{"http", "redirect"}},
+		{name: "unnamed sockets", env: map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "2"}, wantCount: 2, wantNames: []string{"unknown", "unknown"}},
+		{name: "invalid count", env: map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "x"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, names, err := parseListenEnv(func(key string) string { return tt.env[key] }, 42)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseListenEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if count != tt.wantCount || !slices.Equal(names, tt.wantNames) {
+				t.Errorf("parseListenEnv() = %d, %v; want %d, %v", count, names, tt.wantCount, tt.wantNames)
+			}
+		})
+	}
+}
+
+// TestFileListeners verifies passed socket files become listeners grouped by name.
+func TestFileListeners(t *testing.T) {
+	var files []*os.File
+	for range 2 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		file, err := ln.(*net.TCPListener).File()
+		_ = ln.Close()
+		if err != nil {
+			t.Fatalf("Failed to get socket file: %v", err)
+		}
+		files = append(files, file)
+	}
+
+	listeners, err := fileListeners(files, []string{"http", redirectName})
+	if err != nil {
+		t.Fatalf("fileListeners() error = %v", err)
+	}
+	defer Listeners{Main: listeners["http"], Redirect: listeners[redirectName]}.Close()
+
+	if len(listeners["http"]) != 1 || len(listeners[redirectName]) != 1 {
+		t.Errorf("fileListeners() = %v, want one http and one redirect listener", listeners)
+	}
+}
+
+// TestListen_Unix verifies the Unix socket gets its permissions and replaces stale sockets only.
+func TestListen_Unix(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("socket permissions are not supported on Windows")
+	}
+	socket := filepath.Join(t.TempDir(), "goblin.sock")
+	conf := &config.Listen{Socket: socket, SocketMode: "0600"}
+
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+
+	if _, err = Listen(conf, "0", ""); err == nil {
+		t.Fatalf("Listen() on a socket in use = nil, want error")
+	}
+	_ = stale.Close()
+
+	listeners, err := Listen(conf, "0", "")
+	if err != nil {
+		t.Fatalf("Listen() with stale socket error = %v", err)
+	}
+	defer listeners.Close()
+
+	if len(listeners.Main) != 1 || len(listeners.Redirect) != 0 {
+		t.Fatalf("Listen() = %+v, want a single listener", listeners)
+	}
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("Failed to stat socket: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket mode = %o, want 600", perm)
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	_ = conn.Close()
+
+	file := filepath.Join(t.TempDir(), "regular")
+	if err = os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err = Listen(&config.Listen{Socket: file, SocketMode: "0660"}, "0", ""); err == nil {
+		t.Errorf("Listen() on a regular file = nil, want error")
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestNotify verifies states are sent to NOTIFY_SOCKET and skipped without it.
+func TestNotify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("datagram sockets are not supported on Windows")
+	}
+
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := Notify("READY=1"); err != nil {
+		t.Errorf("Notify() without socket error = %v, want nil", err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+
+	if err = Notify("READY=1"); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+	if got := string(buf[:n]); got != "READY=1" {
+		t.Errorf("notification = %q, want %q", got, "READY=1")
+	}
+}
+
+// TestWatchdogInterval verifies the watchdog runs at half the timeout for the watched process only.
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name string
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{name: "disabled", want: 0},
+		{name: "enabled", usec: "30000000", want: 15 * time.Second},
+		{name: "this process", usec: "2000000", pid: strconv.Itoa(os.Getpid()), want: time.Second},
+		{name: "other process", usec: "2000000", pid: "1", want: 0},
+		{name: "invalid", usec: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+			if got := WatchdogInterval(); got != tt.want {
+				t.Errorf("WatchdogInterval() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
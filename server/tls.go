@@ -0,0 +1,132 @@
+// Package server provides the listeners of the HTTP server: TCP and Unix sockets,
+// systemd socket activation and readiness notification, TLS with certificate reloading
+// and the redirect from plain HTTP to HTTPS.
+package server
+
+import (
+	"assetgoblin/config"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertReloader serves a certificate pair from disk and reloads it when the files change.
+// Changes are detected on handshakes at most once per CheckInterval. If the new pair
+// cannot be loaded, e.g. while only one of the files was replaced, the previous certificate
+// is kept and loading is retried on the next check.
+type CertReloader struct {
+	CertFile      string
+	KeyFile       string
+	CheckInterval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	state     [2]fileState
+	checkedAt time.Time
+}
+
+// fileState identifies a version of a certificate or key file.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewCertReloader loads the certificate pair, returning an error if it is invalid.
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{CertFile: certFile, KeyFile: keyFile, CheckInterval: time.Second}
+	state, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err = r.load(state); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, reloading it first if the files changed.
+// It is meant to be used as tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checkedAt) >= r.CheckInterval {
+		r.checkedAt = time.Now()
+		if state, err := r.stat(); err != nil {
+			slog.Warn("Failed to check TLS certificate", "error", err)
+		} else if state != r.state {
+			if err = r.load(state); err != nil {
+				slog.Warn("Failed to reload TLS certificate, keeping the previous one", "error", err)
+			} else {
+				slog.Info("Reloaded TLS certificate", "cert_file", r.CertFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// stat returns the current state of the certificate and key files.
+func (r *CertReloader) stat() ([2]fileState, error) {
+	var state [2]fileState
+	for i, path := range []string{r.CertFile, r.KeyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return state, err
+		}
+		state[i] = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+	return state, nil
+}
+
+// load reads the certificate pair and records the file state it was loaded from.
+func (r *CertReloader) load(state [2]fileState) error {
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	r.cert = &cert
+	r.state = state
+	return nil
+}
+
+// TLSConfig returns the TLS configuration serving the reloader's certificate.
+// HTTP/2 is negotiated via ALPN, with HTTP/1.1 as fallback.
+func TLSConfig(conf *config.TLS, reloader *CertReloader) *tls.Config {
+	minVersion := uint16(tls.VersionTLS12)
+	if conf.MinVersion == "1.3" {
+		minVersion = tls.VersionTLS13
+	}
+	return &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+}
+
+// RedirectHTTPS returns a handler redirecting every request to the same URL over HTTPS on port.
+// GET and HEAD requests are redirected permanently with 301, other methods with 308 to keep the body.
+func RedirectHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]")
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		status := http.StatusPermanentRedirect
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(res, req, "https://"+host+req.URL.RequestURI(), status)
+	})
+}
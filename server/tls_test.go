@@ -0,0 +1,195 @@
+package server
+
+import (
+	"assetgoblin/config"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for localhost with the given serial number.
+func writeCert(t *testing.T, certFile, keyFile string, serial int64) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+}
+
+// TestCertReloader verifies certificates are reloaded when the files change and kept when invalid.
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, 1)
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertReloader() error = %v", err)
+	}
+	reloader.CheckInterval = 0
+
+	serial := func() int64 {
+		t.Helper()
+		cert, err := reloader.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetCertificate() error = %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("Failed to parse certificate: %v", err)
+		}
+		return leaf.SerialNumber.Int64()
+	}
+
+	if got := serial(); got != 1 {
+		t.Fatalf("serial = %d, want 1", got)
+	}
+
+	writeCert(t, certFile, keyFile, 2)
+	future := time.Now().Add(time.Minute)
+	for _, path := range []string{certFile, keyFile} {
+		if err = os.Chtimes(path, future, future); err != nil {
+			t.Fatalf("Failed to touch %s: %v", path, err)
+		}
+	}
+	if got := serial(); got != 2 {
+		t.Errorf("serial after renewal = %d, want 2", got)
+	}
+
+	if err = os.WriteFile(keyFile, []byte("invalid"), 0600); err != nil {
+		t.Fatalf("Failed to corrupt key: %v", err)
+	}
+	if got := serial(); got != 2 {
+		t.Errorf("serial after invalid key = %d, want previous certificate 2", got)
+	}
+
+	if _, err = NewCertReloader(certFile, keyFile); err == nil {
+		t.Errorf("NewCertReloader() with invalid key = nil, want error")
+	}
+}
+
+// TestTLSConfig verifies the server negotiates HTTP/2 and enforces the minimum version.
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCert(t, certFile, keyFile, 1)
+
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertReloader() error = %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			_, _ = res.Write([]byte(req.Proto))
+		}),
+		TLSConfig: TLSConfig(&config.TLS{MinVersion: "1.3"}, reloader),
+		ErrorLog:  log.New(io.Discard, "", 0),
+	}
+	go func() { _ = srv.ServeTLS(listener, "", "") }()
+	defer srv.Close()
+	url := "https://localhost:" + strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+
+	pool := x509.NewCertPool()
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		t.Fatalf("Failed to read certificate: %v", err)
+	}
+	pool.AppendCertsFromPEM(certPEM)
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}, ForceAttemptHTTP2: true}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatalf("GET error = %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("protocol = %s, want HTTP/2", resp.Proto)
+	}
+
+	tls12 := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MaxVersion: tls.VersionTLS12}}}
+	if resp, err = tls12.Get(url); err == nil {
+		_ = resp.Body.Close()
+		t.Errorf("GET with TLS 1.2 succeeded, want handshake failure")
+	}
+}
+
+// TestRedirectHTTPS verifies plain HTTP requests are redirected to the HTTPS port.
+func TestRedirectHTTPS(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		host       string
+		port       string
+		wantStatus int
+		wantURL    string
+	}{
+		{name: "default port", method: http.MethodGet, host: "example.com:80", port: "443", wantStatus: http.StatusMovedPermanently, wantURL: "https://example.com/img/a.jpg?w=1"},
+		{name: "custom port", method: http.MethodGet, host: "example.com", port: "8443", wantStatus: http.StatusMovedPermanently, wantURL: "https://example.com:8443/img/a.jpg?w=1"},
+		{name: "ipv6 host", method: http.MethodHead, host: "[::1]", port: "8443", wantStatus: http.StatusMovedPermanently, wantURL: "https://[::1]:8443/img/a.jpg?w=1"},
+		{name: "post keeps method", method: http.MethodPost, host: "example.com", port: "443", wantStatus: http.StatusPermanentRedirect, wantURL: "https://example.com/img/a.jpg?w=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/img/a.jpg?w=1", nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			RedirectHTTPS(tt.port).ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantURL {
+				t.Errorf("Location = %q, want %q", got, tt.wantURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"assetgoblin/static"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// newStaticService returns the static file service of the public directory with the loaded configuration,
+// so commands and the server agree on which files are hidden.
+func newStaticService(publicDir string) static.Service {
+	return static.Service{Config: &conf.Assets, Compression: &conf.Compression, Security: &conf.Security, PublicDir: publicDir}
+}
+
+// writeManifest writes the manifest of content-hashed URLs of files in the public directory.
+func writeManifest() {
+	if err := conf.Load(); err != nil {
+		slog.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	wd, _ := os.Getwd()
+	staticService := newStaticService(filepath.Join(wd, conf.PublicDir))
+	manifest, file, err := staticService.WriteManifest()
+	if err != nil {
+		slog.Error("Failed to write manifest", "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Wrote %d entries to %s\n", len(manifest), file)
+}
+
+// precompress writes precompressed siblings of the compressible files in the public directory
+// and prints the written files and failures.
+func precompress() {
+	if err := conf.Load(); err != nil {
+		slog.Error("Failed to load config", "error", err)
+		os.Exit(1)
+	}
+
+	wd, _ := os.Getwd()
+	staticService := newStaticService(filepath.Join(wd, conf.PublicDir))
+	result, err := staticService.Precompress()
+	if err != nil {
+		slog.Error("Failed to precompress files", "error", err)
+		os.Exit(1)
+	}
+
+	for _, file := range result.Written {
+		fmt.Println(file)
+	}
+	for file, err := range result.Failures {
+		fmt.Printf("FAILED %s: %v\n", file, err)
+	}
+	fmt.Printf("Wrote %d, up to date %d, failed %d\n", len(result.Written), result.Skipped, len(result.Failures))
+	if len(result.Failures) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,376 @@
+package static
+
+import (
+	"assetgoblin/utils"
+	"cmp"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// encoding is a content coding with the extension of its precompressed files.
+type encoding struct {
+	name string
+	ext  string
+}
+
+// encodings lists the supported content codings in order of preference.
+var encodings = []encoding{
+	{name: "br", ext: ".br"},
+	{name: "zstd", ext: ".zst"},
+	{name: "gzip", ext: ".gz"},
+}
+
+// Compress returns a handler that serves compressed representations of public files through handler.
+// The accepted encoding with the highest quality wins, ties are broken by the order of encodings.
+// A precompressed sibling is served if the client accepts its encoding and it is not older than the file;
+// otherwise compressible files are gzip-compressed on the fly and the compressed copy is cached.
+// Range requests are served uncompressed. ETags of compressed responses carry the encoding as suffix.
+func (s *Service) Compress(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if s.Compression == nil || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+			handler.ServeHTTP(res, req)
+			return
+		}
+
+		file, info, ok := s.resolveFile(req.URL.Path)
+		if !ok || isEncodedFile(file) {
+			handler.ServeHTTP(res, req)
+			return
+		}
+
+		candidates := s.precompressed(file, info)
+		dynamic := s.Compression.Dynamic && s.isCompressible(file, info.Size())
+		if len(candidates) == 0 && !dynamic {
+			handler.ServeHTTP(res, req)
+			return
+		}
+		res.Header().Add("Vary", "Accept-Encoding")
+
+		if req.Header.Get("Range") != "" {
+			handler.ServeHTTP(res, req)
+			return
+		}
+
+		accepted := parseAcceptEncoding(req.Header.Get("Accept-Encoding"))
+		preferred := slices.Clone(encodings)
+		slices.SortStableFunc(preferred, func(a, b encoding) int {
+			return cmp.Compare(accepted[b.name], accepted[a.name])
+		})
+		for _, enc := range preferred {
+			if accepted[enc.name] <= 0 {
+				continue
+			}
+			encoded := ""
+			if slices.Contains(candidates, enc.ext) {
+				encoded = file + enc.ext
+			} else if dynamic && enc.name == "gzip" {
+				var err error
+				if encoded, err = s.cachedGzip(file, info); err != nil {
+					slog.Warn("Failed to compress file", "error", err)
+					continue
+				}
+			}
+			if encoded != "" {
+				serveEncoded(res, req, file, info, encoded, enc.name)
+				return
+			}
+		}
+
+		handler.ServeHTTP(res, req)
+	})
+}
+
+// resolveFile returns the path and info of the regular public file served for the URL path,
+// using the index file for directories.
+func (s *Service) resolveFile(urlPath string) (string, os.FileInfo, bool) {
+	file := filepath.Join(s.PublicDir, filepath.FromSlash(strings.TrimPrefix(path.Clean("/"+urlPath), "/")))
+	info, err := os.Stat(file)
+	if err == nil && info.IsDir() {
+		file = filepath.Join(file, "index.html")
+		info, err = os.Stat(file)
+	}
+	if err != nil || !info.Mode().IsRegular() {
+		return "", nil, false
+	}
+	return file, info, true
+}
+
+// precompressed returns the extensions of the precompressed siblings of file that are not older than it.
+func (s *Service) precompressed(file string, info os.FileInfo) []string {
+	if !s.Compression.Precompressed {
+		return nil
+	}
+
+	var exts []string
+	for _, enc := range encodings {
+		sibling, err := os.Stat(file + enc.ext)
+		if err == nil && sibling.Mode().IsRegular() && !sibling.ModTime().Before(info.ModTime()) {
+			exts = append(exts, enc.ext)
+		}
+	}
+	return exts
+}
+
+// isCompressible reports whether a file of the given size has a MIME type worth compressing.
+func (s *Service) isCompressible(file string, size int64) bool {
+	if size < s.Compression.MinSize {
+		return false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(file)))
+	if mediaType == "" {
+		return false
+	}
+	for _, t := range s.Compression.Types {
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEncodedFile reports whether file is a precompressed sibling itself.
+func isEncodedFile(file string) bool {
+	ext := filepath.Ext(file)
+	for _, enc := range encodings {
+		if ext == enc.ext {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAcceptEncoding returns the quality value of each supported encoding accepted by the header.
+// Encodings matched by "*" only get its quality if they are not listed explicitly.
+func parseAcceptEncoding(header string) map[string]float64 {
+	accepted := map[string]float64{}
+	wildcard := -1.0
+
+	for part := range strings.SplitSeq(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if q, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = q
+			}
+		}
+		if name == "*" {
+			wildcard = quality
+			continue
+		}
+		accepted[name] = quality
+	}
+
+	if wildcard >= 0 {
+		for _, enc := range encodings {
+			if _, ok := accepted[enc.name]; !ok {
+				accepted[enc.name] = wildcard
+			}
+		}
+	}
+	return accepted
+}
+
+// serveEncoded serves the encoded representation of file with the content type of the original.
+// An ETag already set for the original gets the encoding as suffix.
+func serveEncoded(res http.ResponseWriter, req *http.Request, file string, info os.FileInfo, encoded, encodingName string) {
+	body, err := os.Open(encoded)
+	if err != nil {
+		http.Error(res, "Error while opening file", http.StatusInternalServerError)
+		return
+	}
+	defer utils.CloseFile(body)
+
+	header := res.Header()
+	if etag := header.Get("ETag"); strings.HasSuffix(etag, `"`) {
+		header.Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+encodingName+`"`)
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(file)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Encoding", encodingName)
+
+	http.ServeContent(res, req, filepath.Base(file), info.ModTime(), body)
+}
+
+// cachedGzip returns the path of the gzip-compressed copy of file in the compression cache,
+// creating it if needed. Copies are named after the content hash, so changed files get a new copy
+// and the copies of earlier versions are removed.
+func (s *Service) cachedGzip(file string, info os.FileInfo) (string, error) {
+	hash, err := utils.FileHash(file, info)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(s.PublicDir, file)
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve file path: %w", err)
+	}
+
+	cached := filepath.Join(s.Compression.CacheDir, rel+"."+hash[:16]+".gz")
+	if _, err = os.Stat(cached); err == nil {
+		return cached, nil
+	}
+	if err = os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		return "", fmt.Errorf("unable to create compression cache: %w", err)
+	}
+	if err = writeGzip(file, cached); err != nil {
+		return "", err
+	}
+	removeStaleGzip(cached)
+	return cached, nil
+}
+
+// removeStaleGzip removes the copies of earlier versions of the file whose compressed copy is cached.
+func removeStaleGzip(cached string) {
+	dir, name := filepath.Split(cached)
+	prefix := name[:len(name)-len("0123456789abcdef.gz")]
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		other := entry.Name()
+		hash, ok := strings.CutSuffix(strings.TrimPrefix(other, prefix), ".gz")
+		if other == name || !strings.HasPrefix(other, prefix) || !ok || !isHex(hash, 16) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(dir, other)); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove stale compressed copy", "error", err)
+		}
+	}
+}
+
+// isHex reports whether s consists of n lowercase hexadecimal digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// writeGzip writes the gzip-compressed content of file to output.
+// The content is written to a temporary file first, so output is never partially written.
+func writeGzip(file, output string) error {
+	input, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("unable to open file: %w", err)
+	}
+	defer utils.CloseFile(input)
+
+	tmp, err := os.CreateTemp(filepath.Dir(output), "."+filepath.Base(output)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to create compressed file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	writer, _ := gzip.NewWriterLevel(tmp, gzip.BestCompression)
+	if _, err = io.Copy(writer, input); err == nil {
+		err = writer.Close()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to compress file: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), output); err != nil {
+		return fmt.Errorf("unable to write compressed file: %w", err)
+	}
+	return nil
+}
+
+// PrecompressResult reports the outcome of a Precompress run.
+type PrecompressResult struct {
+	Written  []string
+	Skipped  int
+	Failures map[string]error
+}
+
+// Precompress writes precompressed siblings of the compressible files in the public directory:
+// .gz files, and .br and .zst files if the brotli and zstd tools are installed.
+// Siblings that are not older than their file are kept.
+func (s *Service) Precompress() (PrecompressResult, error) {
+	result := PrecompressResult{Failures: map[string]error{}}
+
+	tools := map[string][]string{}
+	if _, err := exec.LookPath("brotli"); err == nil {
+		tools[".br"] = []string{"brotli", "-f", "-k", "-q", "11", "-o"}
+	}
+	if _, err := exec.LookPath("zstd"); err == nil {
+		tools[".zst"] = []string{"zstd", "-f", "-q", "-19", "-o"}
+	}
+
+	err := filepath.WalkDir(s.PublicDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && file != s.PublicDir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), ".") || isEncodedFile(file) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !s.isCompressible(file, info.Size()) {
+			return nil
+		}
+		rel, _ := filepath.Rel(s.PublicDir, file)
+		rel = filepath.ToSlash(rel)
+
+		for _, enc := range encodings {
+			output := file + enc.ext
+			if sibling, err := os.Stat(output); err == nil && !sibling.ModTime().Before(info.ModTime()) {
+				result.Skipped++
+				continue
+			}
+
+			var err error
+			if enc.ext == ".gz" {
+				err = writeGzip(file, output)
+			} else if tool, ok := tools[enc.ext]; ok {
+				err = exec.Command(tool[0], append(tool[1:], output, file)...).Run()
+			} else {
+				continue
+			}
+			if err != nil {
+				result.Failures[rel+enc.ext] = err
+				continue
+			}
+			result.Written = append(result.Written, rel+enc.ext)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("unable to precompress files: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,210 @@
+package static
+
+import (
+	"assetgoblin/config"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestService_Compress verifies encoding negotiation, precompressed siblings and on-the-fly compression.
+func TestService_Compress(t *testing.T) {
+	large := strings.Repeat("body { color: red; }\n", 100)
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		rangeHeader    string
+		staleSibling   bool
+		wantEncoding   string
+		wantBody       string
+		wantVary       bool
+	}{
+		{name: "brotli sibling preferred", path: "/app.js", acceptEncoding: "gzip, br", wantEncoding: "br", wantBody: "brotli", wantVary: true},
+		{name: "quality order", path: "/app.js", acceptEncoding: "br;q=0.5, gzip", wantEncoding: "gzip", wantBody: "gzipped", wantVary: true},
+		{name: "wildcard", path: "/app.js", acceptEncoding: "*;q=0.5, br;q=0", wantEncoding: "zstd", wantBody: "zstandard", wantVary: true},
+		{name: "identity only", path: "/app.js", acceptEncoding: "", wantBody: "console.log(1)", wantVary: true},
+		{name: "stale sibling ignored", path: "/app.js", acceptEncoding: "br", staleSibling: true, wantBody: "console.log(1)"},
+		{name: "range request uncompressed", path: "/app.js", acceptEncoding: "br", rangeHeader: "bytes=0-6", wantBody: "console", wantVary: true},
+		{name: "dynamic gzip", path: "/style.css", acceptEncoding: "gzip", wantEncoding: "gzip", wantBody: large, wantVary: true},
+		{name: "small file not compressed", path: "/small.css", acceptEncoding: "gzip", wantBody: "a{}"},
+		{name: "binary file not compressed", path: "/image.png", acceptEncoding: "gzip", wantBody: strings.Repeat("x", 2048)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			files := map[string]string{
+				"app.js":     "console.log(1)",
+				"app.js.br":  "brotli",
+				"app.js.zst": "zstandard",
+				"app.js.gz":  "gzipped",
+				"style.css":  large,
+				"small.css":  "a{}",
+				"image.png":  strings.Repeat("x", 2048),
+			}
+			now := time.Now()
+			for name, content := range files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to write file: %v", err)
+				}
+				if err := os.Chtimes(filepath.Join(dir, name), now, now); err != nil {
+					t.Fatalf("Failed to touch file: %v", err)
+				}
+			}
+			if tt.staleSibling {
+				later := time.Now().Add(time.Hour)
+				if err := os.Chtimes(filepath.Join(dir, "app.js"), later, later); err != nil {
+					t.Fatalf("Failed to touch file: %v", err)
+				}
+			}
+
+			service := &Service{PublicDir: dir, Compression: &config.Compression{
+				CacheDir:      t.TempDir(),
+				Dynamic:       true,
+				MinSize:       1024,
+				Precompressed: true,
+				Types:         []string{"text/", "image/svg+xml"},
+			}}
+			handler := service.Compress(http.FileServer(http.Dir(dir)))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := rec.Header().Get("Vary") == "Accept-Encoding"; got != tt.wantVary {
+				t.Errorf("Vary set = %v, want %v", got, tt.wantVary)
+			}
+
+			body := rec.Body.Bytes()
+			if tt.wantEncoding == "gzip" && tt.wantBody == large {
+				reader, err := gzip.NewReader(bytes.NewReader(body))
+				if err != nil {
+					t.Fatalf("Failed to read gzip body: %v", err)
+				}
+				if body, err = io.ReadAll(reader); err != nil {
+					t.Fatalf("Failed to decompress body: %v", err)
+				}
+			}
+			if string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+// TestService_CachedGzip verifies a changed file replaces its cached compressed copy,
+// while the copies of other files sharing the name as prefix are kept.
+func TestService_CachedGzip(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := t.TempDir()
+	service := &Service{PublicDir: dir, Compression: &config.Compression{CacheDir: cacheDir}}
+
+	compress := func(name, content string, modTime time.Time) string {
+		t.Helper()
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatalf("Failed to touch file: %v", err)
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Failed to stat file: %v", err)
+		}
+		cached, err := service.cachedGzip(file, info)
+		if err != nil {
+			t.Fatalf("cachedGzip() error = %v", err)
+		}
+		return cached
+	}
+
+	now := time.Now()
+	other := compress("app.js.map", "map", now)
+	old := compress("app.js", "console.log(1)", now)
+	current := compress("app.js", "console.log(2)", now.Add(time.Minute))
+	if current == old {
+		t.Fatalf("cachedGzip() = %s for changed content, want a new copy", current)
+	}
+
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to read compression cache: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{filepath.Base(current), filepath.Base(other)}; !slices.Equal(names, want) {
+		t.Errorf("compression cache = %v, want %v", names, want)
+	}
+}
+
+// TestService_Precompress verifies gzip siblings are written for compressible files only and kept while fresh.
+func TestService_Precompress(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"app.js":       strings.Repeat("console.log(1);\n", 100),
+		"small.js":     "1",
+		"image.png":    strings.Repeat("x", 2048),
+		".hidden.js":   strings.Repeat("x", 2048),
+		"data/app.css": strings.Repeat("a{}\n", 500),
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	service := &Service{PublicDir: dir, Compression: &config.Compression{MinSize: 1024, Types: []string{"text/"}}}
+	result, err := service.Precompress()
+	if err != nil {
+		t.Fatalf("Precompress() error = %v", err)
+	}
+	if len(result.Failures) != 0 {
+		t.Errorf("Precompress() failures = %v", result.Failures)
+	}
+
+	for _, name := range []string{"app.js.gz", "data/app.css.gz"} {
+		if _, err = os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("%s not written: %v", name, err)
+		}
+	}
+	for _, name := range []string{"small.js.gz", "image.png.gz", ".hidden.js.gz"} {
+		if _, err = os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s written, want no sibling", name)
+		}
+	}
+
+	again, err := service.Precompress()
+	if err != nil {
+		t.Fatalf("Precompress() error = %v", err)
+	}
+	for _, written := range again.Written {
+		if strings.HasSuffix(written, ".gz") {
+			t.Errorf("Precompress() rewrote fresh sibling %s", written)
+		}
+	}
+}
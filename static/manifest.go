@@ -0,0 +1,78 @@
+package static
+
+import (
+	"assetgoblin/utils"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Manifest maps paths of public files to their hashed paths, both relative to the public directory.
+type Manifest map[string]string
+
+// BuildManifest hashes the selected files in the public directory.
+func (s *Service) BuildManifest() (Manifest, error) {
+	manifest := Manifest{}
+
+	err := filepath.WalkDir(s.PublicDir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.PublicDir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if !s.isSelected(rel) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hash, err := utils.FileHash(file, info)
+		if err != nil {
+			return err
+		}
+		dir, name := path.Split(rel)
+		manifest[rel] = dir + s.hashedName(name, hash)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to build manifest: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// WriteManifest builds the manifest and writes it as JSON to the configured manifest path.
+// Returns the manifest and the path it was written to.
+func (s *Service) WriteManifest() (Manifest, string, error) {
+	manifest, err := s.BuildManifest()
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to encode manifest: %w", err)
+	}
+
+	file := filepath.Join(s.PublicDir, s.Config.Manifest)
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, "", fmt.Errorf("unable to create manifest directory: %w", err)
+	}
+	if err = os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		return nil, "", fmt.Errorf("unable to write manifest: %w", err)
+	}
+
+	return manifest, file, nil
+}
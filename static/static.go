@@ -0,0 +1,192 @@
+// Package static provides content-hashed URLs and compressed responses for files in the public directory.
+// Hashed URLs embed a prefix of the content hash in the file name, so they can be cached forever
+// and change whenever the content changes.
+package static
+
+import (
+	"assetgoblin/config"
+	"assetgoblin/utils"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Service resolves content-hashed URLs of files in the public directory and serves them compressed.
+type Service struct {
+	Config      *config.Assets
+	Compression *config.Compression
+	Security    *config.Security
+	PublicDir   string
+}
+
+// hashedName returns the hashed file name of name for the content hash,
+// e.g. "app.3f9a1c2b.css" for "app.css".
+func (s *Service) hashedName(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash[:s.Config.HashLength] + ext
+}
+
+// hashedCandidate is a possible original file name of a hashed file name, along with the hash.
+type hashedCandidate struct {
+	name string
+	hash string
+}
+
+// parseHashedName returns the possible original file names of a hashed file name:
+// "app.css" for "app.3f9a1c2b.css" and, for files without extension, "LICENSE" for "LICENSE.3f9a1c2b".
+func (s *Service) parseHashedName(name string) []hashedCandidate {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	var candidates []hashedCandidate
+	if hash := strings.TrimPrefix(path.Ext(stem), "."); s.isHash(hash) {
+		candidates = append(candidates, hashedCandidate{name: strings.TrimSuffix(stem, "."+hash) + ext, hash: hash})
+	}
+	if hash := strings.TrimPrefix(ext, "."); s.isHash(hash) && stem != "" {
+		candidates = append(candidates, hashedCandidate{name: stem, hash: hash})
+	}
+	return candidates
+}
+
+// isHash reports whether value looks like a hash prefix of the configured length.
+func (s *Service) isHash(value string) bool {
+	if len(value) != s.Config.HashLength {
+		return false
+	}
+	for _, c := range value {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// isSelected reports whether the file at the slash-separated path relative to the public directory
+// gets a hashed URL: it matches the include patterns, if any, and none of the exclude patterns.
+// Dotfiles, hidden files and the manifest itself are never selected.
+func (s *Service) isSelected(rel string) bool {
+	for part := range strings.SplitSeq(rel, "/") {
+		if strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	if s.isHidden(rel) {
+		return false
+	}
+	if rel == filepath.ToSlash(filepath.Clean(s.Config.Manifest)) {
+		return false
+	}
+	if len(s.Config.Include) > 0 && !utils.MatchesGlob(s.Config.Include, rel) {
+		return false
+	}
+	return !utils.MatchesGlob(s.Config.Exclude, rel)
+}
+
+// isHidden reports whether the file at the slash-separated path relative to the public directory must not be served:
+// it or one of its parent directories is a dotfile outside .well-known, if dotfiles are hidden, or matches a hidden pattern.
+func (s *Service) isHidden(rel string) bool {
+	if s.Security == nil || rel == "" {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i, part := range parts {
+		if s.Security.HideDotfiles && strings.HasPrefix(part, ".") && !(i == 0 && part == ".well-known") {
+			return true
+		}
+		if utils.MatchesGlob(s.Security.Hidden, strings.Join(parts[:i+1], "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Protect returns a handler that answers requests for hidden files with 404 and, unless directory
+// listing is enabled, requests for directories without index.html. Everything else is passed to handler.
+func (s *Service) Protect(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		rel := strings.TrimPrefix(path.Clean("/"+req.URL.Path), "/")
+		if s.isHidden(rel) {
+			http.NotFound(res, req)
+			return
+		}
+
+		if s.Security != nil && !s.Security.DirectoryListing {
+			dir := filepath.Join(s.PublicDir, filepath.FromSlash(rel))
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				if _, err = os.Stat(filepath.Join(dir, "index.html")); err != nil {
+					http.NotFound(res, req)
+					return
+				}
+			}
+		}
+
+		handler.ServeHTTP(res, req)
+	})
+}
+
+// Resolve returns a handler that serves hashed URLs of public files through handler.
+// Requests for files that exist as named are passed through unchanged. A hashed URL whose hash
+// matches the current content is served from the original file with the configured Cache-Control
+// header; a stale hash is redirected to the current hashed URL or answered with 404.
+func (s *Service) Resolve(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		urlPath := path.Clean("/" + req.URL.Path)
+		dir, name := path.Split(urlPath)
+
+		candidates := s.parseHashedName(name)
+		if len(candidates) == 0 || s.exists(urlPath) {
+			handler.ServeHTTP(res, req)
+			return
+		}
+
+		for _, candidate := range candidates {
+			originalPath := dir + candidate.name
+			rel := strings.TrimPrefix(originalPath, "/")
+			file := filepath.Join(s.PublicDir, filepath.FromSlash(rel))
+			info, err := os.Stat(file)
+			if err != nil || !info.Mode().IsRegular() || !s.isSelected(rel) {
+				continue
+			}
+			current, err := utils.FileHash(file, info)
+			if err != nil {
+				http.Error(res, "Error while hashing file", http.StatusInternalServerError)
+				return
+			}
+
+			if current[:s.Config.HashLength] != candidate.hash {
+				if s.Config.Stale == "not_found" {
+					http.NotFound(res, req)
+					return
+				}
+				target := dir + s.hashedName(candidate.name, current)
+				if req.URL.RawQuery != "" {
+					target += "?" + req.URL.RawQuery
+				}
+				res.Header().Set("Cache-Control", "no-cache")
+				http.Redirect(res, req, target, http.StatusFound)
+				return
+			}
+
+			if s.Config.CacheControl != "" {
+				res.Header().Set("Cache-Control", s.Config.CacheControl)
+			}
+			rewritten := *req.URL
+			rewritten.Path = originalPath
+			rewritten.RawPath = ""
+			original := req.Clone(req.Context())
+			original.URL = &rewritten
+			handler.ServeHTTP(res, original)
+			return
+		}
+
+		handler.ServeHTTP(res, req)
+	})
+}
+
+// exists reports whether the URL path names an existing file or directory in the public directory.
+func (s *Service) exists(urlPath string) bool {
+	_, err := os.Stat(filepath.Join(s.PublicDir, filepath.FromSlash(strings.TrimPrefix(urlPath, "/"))))
+	return err == nil
+}
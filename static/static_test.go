@@ -0,0 +1,192 @@
+package static
+
+import (
+	"assetgoblin/config"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestService_BuildManifest verifies selected public files are mapped to their hashed paths.
+func TestService_BuildManifest(t *testing.T) {
+	service := createStaticService(t, config.Assets{Exclude: []string{"*.txt"}})
+
+	manifest, file, err := service.WriteManifest()
+	if err != nil {
+		t.Fatalf("WriteManifest() error = %v", err)
+	}
+
+	want := Manifest{
+		"app.css":      "app." + hashPrefix(t, "body{}") + ".css",
+		"js/app.js":    "js/app." + hashPrefix(t, "alert(1)") + ".js",
+		"LICENSE":      "LICENSE." + hashPrefix(t, "MIT"),
+		"js/vendor.js": "js/vendor." + hashPrefix(t, "vendor") + ".js",
+	}
+	if len(manifest) != len(want) {
+		t.Errorf("BuildManifest() = %v, want %v", manifest, want)
+	}
+	for source, hashed := range want {
+		if manifest[source] != hashed {
+			t.Errorf("manifest[%q] = %q, want %q", source, manifest[source], hashed)
+		}
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	var written Manifest
+	if err = json.Unmarshal(data, &written); err != nil || written["app.css"] != want["app.css"] {
+		t.Errorf("written manifest = %s, error = %v", data, err)
+	}
+}
+
+// TestService_Resolve verifies hashed URLs are served, stale hashes are redirected or rejected
+// and other requests are passed through.
+func TestService_Resolve(t *testing.T) {
+	cssHash := hashPrefix(t, "body{}")
+
+	tests := []struct {
+		name             string
+		stale            string
+		path             string
+		wantStatus       int
+		wantBody         string
+		wantCacheControl string
+		wantLocation     string
+	}{
+		{name: "current hash", path: "/app." + cssHash + ".css", wantStatus: http.StatusOK, wantBody: "body{}", wantCacheControl: "public, max-age=31536000, immutable"},
+		{name: "current hash without extension", path: "/LICENSE." + hashPrefix(t, "MIT"), wantStatus: http.StatusOK, wantBody: "MIT", wantCacheControl: "public, max-age=31536000, immutable"},
+		{name: "stale hash redirect", stale: "redirect", path: "/app.00000000.css?v=1", wantStatus: http.StatusFound, wantCacheControl: "no-cache", wantLocation: "/app." + cssHash + ".css?v=1"},
+		{name: "stale hash not found", stale: "not_found", path: "/app.00000000.css", wantStatus: http.StatusNotFound},
+		{name: "excluded file", path: "/notes." + hashPrefix(t, "notes") + ".txt", wantStatus: http.StatusNotFound},
+		{name: "plain file", path: "/app.css", wantStatus: http.StatusOK, wantBody: "body{}"},
+		{name: "literal hashed file", path: "/legacy.12345678.js", wantStatus: http.StatusOK, wantBody: "legacy"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := createStaticService(t, config.Assets{Exclude: []string{"*.txt"}, Stale: tt.stale})
+			handler := service.Resolve(http.FileServer(http.Dir(service.PublicDir)))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.wantCacheControl {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCacheControl)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+// TestService_Protect verifies dotfiles, hidden patterns and directories without index are answered with 404.
+func TestService_Protect(t *testing.T) {
+	service := createStaticService(t, config.Assets{})
+	for _, name := range []string{".well-known/security.txt", ".git/config", "private/keys.pem", "backup/site.bak", "docs/index.html"} {
+		file := filepath.Join(service.PublicDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		security   config.Security
+		path       string
+		wantStatus int
+	}{
+		{name: "dotfile", security: config.Security{HideDotfiles: true}, path: "/.env", wantStatus: http.StatusNotFound},
+		{name: "file in dot directory", security: config.Security{HideDotfiles: true}, path: "/.git/config", wantStatus: http.StatusNotFound},
+		{name: "encoded dot directory", security: config.Security{HideDotfiles: true}, path: "/js/../%2Egit/config", wantStatus: http.StatusNotFound},
+		{name: "well-known", security: config.Security{HideDotfiles: true}, path: "/.well-known/security.txt", wantStatus: http.StatusOK},
+		{name: "dotfiles shown", security: config.Security{}, path: "/.env", wantStatus: http.StatusOK},
+		{name: "hidden directory", security: config.Security{Hidden: []string{"private"}}, path: "/private/keys.pem", wantStatus: http.StatusNotFound},
+		{name: "hidden extension", security: config.Security{Hidden: []string{"*.bak"}}, path: "/backup/site.bak", wantStatus: http.StatusNotFound},
+		{name: "hidden path pattern", security: config.Security{Hidden: []string{"backup/*"}}, path: "/backup/site.bak", wantStatus: http.StatusNotFound},
+		{name: "listing disabled", security: config.Security{}, path: "/js/", wantStatus: http.StatusNotFound},
+		{name: "listing enabled", security: config.Security{DirectoryListing: true}, path: "/js/", wantStatus: http.StatusOK},
+		{name: "directory with index", security: config.Security{}, path: "/docs/", wantStatus: http.StatusOK},
+		{name: "hashed url of hidden file", security: config.Security{Hidden: []string{"app.css"}}, path: "/app." + hashPrefix(t, "body{}") + ".css", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service.Security = &tt.security
+			handler := service.Protect(service.Resolve(http.FileServer(http.Dir(service.PublicDir))))
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// createStaticService creates a public directory with a few files and returns a service for it.
+// Unset settings get their defaults.
+func createStaticService(t *testing.T, cfg config.Assets) *Service {
+	t.Helper()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"app.css":            "body{}",
+		"js/app.js":          "alert(1)",
+		"js/vendor.js":       "vendor",
+		"LICENSE":            "MIT",
+		"notes.txt":          "notes",
+		"legacy.12345678.js": "legacy",
+		".env":               "SECRET=1",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	if cfg.HashLength == 0 {
+		cfg.HashLength = 8
+	}
+	if cfg.Stale == "" {
+		cfg.Stale = "redirect"
+	}
+	if cfg.Manifest == "" {
+		cfg.Manifest = "manifest.json"
+	}
+	if cfg.CacheControl == "" {
+		cfg.CacheControl = "public, max-age=31536000, immutable"
+	}
+	cfg.Exclude = append(cfg.Exclude, "legacy.*")
+
+	return &Service{Config: &cfg, PublicDir: dir}
+}
+
+// hashPrefix returns the default-length hash prefix of content.
+func hashPrefix(t *testing.T, content string) string {
+	t.Helper()
+
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])[:8]
+}
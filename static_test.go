@@ -0,0 +1,37 @@
+package main
+
+import (
+	"assetgoblin/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestNewStaticService_Manifest verifies the manifest command leaves out hidden files,
+// which the server would not serve under their hashed URLs.
+func TestNewStaticService_Manifest(t *testing.T) {
+	saved := conf
+	t.Cleanup(func() { conf = saved })
+
+	dir := t.TempDir()
+	for _, name := range []string{"app.css", "private/keys.json", "backup.bak"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	conf.Assets = config.Assets{HashLength: 8, Manifest: "manifest.json", Stale: "redirect"}
+	conf.Security = config.Security{Hidden: []string{"private", "*.bak"}, HideDotfiles: true}
+
+	service := newStaticService(dir)
+	manifest, err := service.BuildManifest()
+	if err != nil {
+		t.Fatalf("BuildManifest() error = %v", err)
+	}
+	if _, ok := manifest["app.css"]; !ok || len(manifest) != 1 {
+		t.Errorf("BuildManifest() = %v, want only app.css", manifest)
+	}
+}
@@ -0,0 +1,232 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Export limits: a batch is sent once maxBatch spans are queued, and spans are dropped
+// while maxQueue spans are waiting, e.g. because the collector is unreachable.
+const (
+	maxBatch = 512
+	maxQueue = 4096
+)
+
+// exporter sends finished spans in batches to an OTLP/HTTP endpoint.
+type exporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// newExporter creates an exporter and starts sending batches every interval.
+func newExporter(endpoint, serviceName string, interval time.Duration) *exporter {
+	e := &exporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		flush:       make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go e.run(interval)
+	return e
+}
+
+// enqueue queues a finished span, triggering an export once a batch is full.
+func (e *exporter) enqueue(span *Span) {
+	e.mu.Lock()
+	if len(e.queue) >= maxQueue {
+		e.dropped++
+		e.mu.Unlock()
+		return
+	}
+	e.queue = append(e.queue, span)
+	full := len(e.queue) >= maxBatch
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run exports the queued spans every interval or when a batch is full, until shutdown.
+func (e *exporter) run(interval time.Duration) {
+	defer close(e.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flush:
+		case <-e.stop:
+			return
+		}
+		if err := e.export(context.Background()); err != nil {
+			slog.Warn("Failed to export spans", "error", err)
+		}
+	}
+}
+
+// shutdown stops the background export and sends the remaining spans.
+func (e *exporter) shutdown(ctx context.Context) error {
+	close(e.stop)
+	<-e.done
+	return e.export(ctx)
+}
+
+// export sends all queued spans in batches.
+func (e *exporter) export(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		n := min(len(e.queue), maxBatch)
+		batch := e.queue[:n:n]
+		e.queue = e.queue[n:]
+		dropped := e.dropped
+		e.dropped = 0
+		e.mu.Unlock()
+
+		if dropped > 0 {
+			slog.Warn("Dropped spans while the export queue was full", "spans", dropped)
+		}
+		if n == 0 {
+			return nil
+		}
+		if err := e.send(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
+
+// send posts a batch of spans encoded as OTLP JSON.
+func (e *exporter) send(ctx context.Context, batch []*Span) error {
+	body, err := json.Marshal(e.encode(batch))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("collector responded with %s", res.Status)
+	}
+	return nil
+}
+
+// OTLP JSON structures of an export request.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string         `json:"key"`
+		Value map[string]any `json:"value"`
+	}
+)
+
+// encode converts a batch of spans into an OTLP export request.
+func (e *exporter) encode(batch []*Span) otlpRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, span := range batch {
+		span.mu.Lock()
+		encoded := otlpSpan{
+			TraceID:           hex.EncodeToString(span.traceID[:]),
+			SpanID:            hex.EncodeToString(span.spanID[:]),
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: span.status, Message: span.message},
+		}
+		if span.parentID != (SpanID{}) {
+			encoded.ParentSpanID = hex.EncodeToString(span.parentID[:])
+		}
+		for _, attr := range span.attributes {
+			encoded.Attributes = append(encoded.Attributes, encodeAttribute(attr.key, attr.value))
+		}
+		span.mu.Unlock()
+		spans = append(spans, encoded)
+	}
+
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{encodeAttribute("service.name", e.serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "assetgoblin"}, Spans: spans}},
+	}}}
+}
+
+// encodeAttribute encodes an attribute value as an OTLP AnyValue.
+func encodeAttribute(key string, value any) otlpAttribute {
+	var encoded map[string]any
+	switch v := value.(type) {
+	case bool:
+		encoded = map[string]any{"boolValue": v}
+	case int:
+		encoded = map[string]any{"intValue": strconv.Itoa(v)}
+	case int64:
+		encoded = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		encoded = map[string]any{"doubleValue": v}
+	default:
+		encoded = map[string]any{"stringValue": fmt.Sprint(v)}
+	}
+	return otlpAttribute{Key: key, Value: encoded}
+}
@@ -0,0 +1,166 @@
+// Package tracing records spans of requests and exports them to an OpenTelemetry collector
+// via OTLP/HTTP in the JSON encoding. Trace context is propagated with W3C traceparent headers.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span kinds and status codes as defined by OTLP.
+const (
+	KindInternal = 1
+	KindServer   = 2
+
+	statusError = 2
+)
+
+// TraceID and SpanID identify traces and spans.
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+// Span is a timed operation within a trace. All methods are safe to call on a nil span,
+// which is returned for operations that are not traced.
+type Span struct {
+	tracer   *Tracer
+	traceID  TraceID
+	spanID   SpanID
+	parentID SpanID
+	name     string
+	kind     int
+	start    time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	attributes []attribute
+	status     int
+	message    string
+}
+
+// attribute is a key-value pair of a span. Values are strings, bools, ints or float64s.
+type attribute struct {
+	key   string
+	value any
+}
+
+// spanKey is the context key of the current span.
+type spanKey struct{}
+
+// FromContext returns the current span of ctx, or nil if ctx is not traced.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start starts a child span of the current span of ctx and returns a context carrying it.
+// If ctx is not traced, ctx is returned with a nil span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	parent := FromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	span := &Span{
+		tracer:   parent.tracer,
+		traceID:  parent.traceID,
+		spanID:   newSpanID(),
+		parentID: parent.spanID,
+		name:     name,
+		kind:     KindInternal,
+		start:    time.Now(),
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetAttribute sets an attribute of the span.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes = append(s.attributes, attribute{key: key, value: value})
+}
+
+// SetError marks the span as failed with the error message. A nil error does nothing.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status, s.message = statusError, err.Error()
+}
+
+// End ends the span and queues it for export. Only the first call has an effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	s.tracer.exporter.enqueue(s)
+}
+
+// Traceparent returns the W3C traceparent header value identifying the span, or an empty string for nil spans.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(s.traceID[:]), hex.EncodeToString(s.spanID[:]))
+}
+
+// parseTraceparent parses a W3C traceparent header value into the trace ID, the parent span ID
+// and the sampled flag. It returns false for missing or malformed values and all-zero IDs.
+func parseTraceparent(value string) (TraceID, SpanID, bool, bool) {
+	var traceID TraceID
+	var spanID SpanID
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return traceID, spanID, false, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, spanID, false, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == (TraceID{}) {
+		return traceID, spanID, false, false
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil || spanID == (SpanID{}) {
+		return traceID, spanID, false, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return traceID, spanID, false, false
+	}
+	if strings.ToLower(value) != value {
+		return traceID, spanID, false, false
+	}
+	return traceID, spanID, flags[0]&1 == 1, true
+}
+
+// newTraceID returns a random trace ID.
+func newTraceID() TraceID {
+	var id TraceID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// newSpanID returns a random span ID.
+func newSpanID() SpanID {
+	var id SpanID
+	_, _ = rand.Read(id[:])
+	return id
+}
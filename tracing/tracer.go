@@ -0,0 +1,120 @@
+package tracing
+
+import (
+	"assetgoblin/config"
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// signingParams are the query parameters of signed URLs, which are not exported,
+// so the collector cannot be used to replay signed requests.
+var signingParams = []string{"token", "expires"}
+
+// Tracer starts the root spans of requests and exports the finished spans.
+type Tracer struct {
+	Config   *config.Tracing
+	exporter *exporter
+}
+
+// NewTracer creates a tracer exporting to the configured endpoint and starts the background export.
+func NewTracer(cfg *config.Tracing) *Tracer {
+	t := &Tracer{Config: cfg}
+	t.exporter = newExporter(cfg.Endpoint, cfg.ServiceName, 5*time.Second)
+	return t
+}
+
+// Shutdown exports the queued spans and stops the background export.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	return t.exporter.shutdown(ctx)
+}
+
+// Middleware returns a middleware handler that traces each request in a server span.
+// An incoming traceparent header continues the trace and decides about sampling;
+// otherwise, new traces are sampled at the configured rate.
+func (t *Tracer) Middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		traceID, parentID, sampled, ok := parseTraceparent(req.Header.Get("traceparent"))
+		if !ok {
+			traceID, parentID = newTraceID(), SpanID{}
+			sampled = t.Config.SampleRate >= 1 || (t.Config.SampleRate > 0 && rand.Float64() < t.Config.SampleRate)
+		}
+		if !sampled {
+			handler.ServeHTTP(res, req)
+			return
+		}
+
+		span := &Span{
+			tracer:   t,
+			traceID:  traceID,
+			spanID:   newSpanID(),
+			parentID: parentID,
+			name:     req.Method,
+			kind:     KindServer,
+			start:    time.Now(),
+		}
+		span.SetAttribute("http.request.method", req.Method)
+		span.SetAttribute("url.path", req.URL.Path)
+		if query := redactQuery(req.URL.RawQuery); query != "" {
+			span.SetAttribute("url.query", query)
+		}
+		span.SetAttribute("user_agent.original", req.UserAgent())
+
+		writer := &statusWriter{ResponseWriter: res}
+		handler.ServeHTTP(writer, req.WithContext(context.WithValue(req.Context(), spanKey{}, span)))
+
+		status := writer.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttribute("http.response.status_code", status)
+		if status >= http.StatusInternalServerError {
+			span.SetError(errors.New(http.StatusText(status)))
+		}
+		span.End()
+	})
+}
+
+// redactQuery returns the raw query without the signing parameters.
+// Queries that cannot be parsed are dropped entirely.
+func redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return ""
+	}
+	for _, name := range signingParams {
+		query.Del(name)
+	}
+	return query.Encode()
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap returns the underlying response writer for http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
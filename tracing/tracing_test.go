@@ -0,0 +1,154 @@
+package tracing
+
+import (
+	"assetgoblin/config"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// TestParseTraceparent verifies valid headers are parsed and malformed ones rejected.
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		wantOK      bool
+		wantSampled bool
+	}{
+		{name: "sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantOK: true, wantSampled: true},
+		{name: "not sampled", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", wantOK: true},
+		{name: "future version", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", wantOK: true, wantSampled: true},
+		{name: "empty", value: ""},
+		{name: "invalid version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "zero trace id", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "zero span id", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{name: "uppercase", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01"},
+		{name: "short trace id", value: "00-4bf92f3577b34da6-00f067aa0ba902b7-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			traceID, spanID, sampled, ok := parseTraceparent(tt.value)
+			if ok != tt.wantOK || sampled != tt.wantSampled {
+				t.Fatalf("parseTraceparent() = sampled %v, ok %v; want %v, %v", sampled, ok, tt.wantSampled, tt.wantOK)
+			}
+			if ok && (hex.EncodeToString(traceID[:]) != "4bf92f3577b34da6a3ce929d0e0e4736" || hex.EncodeToString(spanID[:]) != "00f067aa0ba902b7") {
+				t.Errorf("parseTraceparent() = %x, %x", traceID, spanID)
+			}
+		})
+	}
+}
+
+// collector is a stand-in OTLP collector recording the exported spans.
+type collector struct {
+	mu    sync.Mutex
+	spans []otlpSpan
+}
+
+func (c *collector) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	var export otlpRequest
+	if err := json.Unmarshal(body, &export); err != nil || req.Header.Get("Content-Type") != "application/json" {
+		http.Error(res, "invalid export", http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, resourceSpans := range export.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			c.spans = append(c.spans, scopeSpans.Spans...)
+		}
+	}
+}
+
+// TestTracer_Middleware verifies request and child spans continue the incoming trace and are exported.
+func TestTracer_Middleware(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	tracer := NewTracer(&config.Tracing{Endpoint: server.URL + "/v1/traces", SampleRate: 0, ServiceName: "test"})
+	handler := tracer.Middleware(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		_, span := Start(req.Context(), "image.transform")
+		span.SetAttribute("image.backend", "vips")
+		span.SetError(errors.New("conversion failed"))
+		span.End()
+		res.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/img/a.jpg", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	unsampled := httptest.NewRequest(http.MethodGet, "/img/b.jpg", nil)
+	unsampled.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	handler.ServeHTTP(httptest.NewRecorder(), unsampled)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/img/c.jpg", nil))
+
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2: %+v", len(c.spans), c.spans)
+	}
+	child, root := c.spans[0], c.spans[1]
+	if root.Name != http.MethodGet || root.Kind != KindServer || root.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("root span = %+v, want GET server span with the incoming parent", root)
+	}
+	if root.Status.Code != statusError {
+		t.Errorf("root status = %+v, want error for 500", root.Status)
+	}
+	if child.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || child.ParentSpanID != root.SpanID {
+		t.Errorf("child span = %+v, want child of %s in the incoming trace", child, root.SpanID)
+	}
+	if child.Status.Message != "conversion failed" || len(child.Attributes) != 1 || child.Attributes[0].Value["stringValue"] != "vips" {
+		t.Errorf("child span = %+v, want error and backend attribute", child)
+	}
+}
+
+// TestRedactQuery verifies the signing parameters are removed from exported queries.
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "empty", query: "", want: ""},
+		{name: "unsigned", query: "fit=cover&rotate=90", want: "fit=cover&rotate=90"},
+		{name: "signed", query: "fit=cover&expires=1767225600&token=abc", want: "fit=cover"},
+		{name: "only signing parameters", query: "expires=1767225600&token=abc", want: ""},
+		{name: "malformed", query: "token=%zz", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactQuery(tt.query); got != tt.want {
+				t.Errorf("redactQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestStart_Untraced verifies spans are not recorded outside traced requests.
+func TestStart_Untraced(t *testing.T) {
+	ctx, span := Start(context.Background(), "image.cache_lookup")
+	if span != nil || FromContext(ctx) != nil {
+		t.Fatalf("Start() without parent = %v, want nil span", span)
+	}
+	span.SetAttribute("image.cache.hit", true)
+	span.SetError(errors.New("ignored"))
+	span.End()
+	if got := span.Traceparent(); got != "" {
+		t.Errorf("Traceparent() of nil span = %q, want empty", got)
+	}
+}
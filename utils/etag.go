@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// hashEntry is a memoized content hash along with the file state it was computed for.
+type hashEntry struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// maxHashes bounds the number of memoized content hashes.
+const maxHashes = 10000
+
+// hashes memoizes content hashes by file path. Once maxHashes paths are memoized, the memo is
+// cleared before another path is added, so paths of deleted files do not accumulate.
+var hashes = struct {
+	mu      sync.Mutex
+	entries map[string]hashEntry
+}{entries: map[string]hashEntry{}}
+
+// FileETag returns a strong ETag derived from the content hash of the file at path, described by info.
+func FileETag(path string, info os.FileInfo) (string, error) {
+	hash, err := FileHash(path, info)
+	if err != nil {
+		return "", err
+	}
+	return `"` + hash[:32] + `"`, nil
+}
+
+// FileHash returns the hex-encoded SHA-256 hash of the content of the file at path, described by info.
+// Hashes are memoized per path and replaced once the modification time or size of the file changes.
+func FileHash(path string, info os.FileInfo) (string, error) {
+	hashes.mu.Lock()
+	entry, ok := hashes.entries[path]
+	hashes.mu.Unlock()
+	if ok && entry.modTime.Equal(info.ModTime()) && entry.size == info.Size() {
+		return entry.hash, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to open file: %w", err)
+	}
+	defer CloseFile(file)
+
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, file); err != nil {
+		return "", fmt.Errorf("unable to hash file: %w", err)
+	}
+
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	hashes.mu.Lock()
+	if _, ok = hashes.entries[path]; !ok && len(hashes.entries) >= maxHashes {
+		clear(hashes.entries)
+	}
+	hashes.entries[path] = hashEntry{modTime: info.ModTime(), size: info.Size(), hash: hash}
+	hashes.mu.Unlock()
+	return hash, nil
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestFileETag verifies ETags are strong, stable and change with the file content.
+func TestFileETag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	etag := func(content string, modTime time.Time) string {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat file: %v", err)
+		}
+		tag, err := FileETag(path, info)
+		if err != nil {
+			t.Fatalf("FileETag() error = %v", err)
+		}
+		return tag
+	}
+
+	now := time.Now()
+	first := etag("hello", now)
+	if !strings.HasPrefix(first, `"`) || !strings.HasSuffix(first, `"`) || strings.HasPrefix(first, "W/") {
+		t.Errorf("FileETag() = %s, want a strong quoted ETag", first)
+	}
+	if again := etag("hello", now.Add(time.Minute)); again != first {
+		t.Errorf("FileETag() = %s after touch, want %s", again, first)
+	}
+	if changed := etag("world", now.Add(2*time.Minute)); changed == first {
+		t.Errorf("FileETag() unchanged after content change")
+	}
+}
+
+// TestFileHash_Bounded verifies the memoized hashes stay bounded.
+func TestFileHash_Bounded(t *testing.T) {
+	hashes.mu.Lock()
+	for i := range maxHashes {
+		hashes.entries[filepath.Join("deleted", strconv.Itoa(i))] = hashEntry{hash: "stale"}
+	}
+	hashes.mu.Unlock()
+	t.Cleanup(func() {
+		hashes.mu.Lock()
+		clear(hashes.entries)
+		hashes.mu.Unlock()
+	})
+
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	if _, err = FileHash(path, info); err != nil {
+		t.Fatalf("FileHash() error = %v", err)
+	}
+
+	hashes.mu.Lock()
+	defer hashes.mu.Unlock()
+	if len(hashes.entries) > maxHashes {
+		t.Errorf("len(hashes) = %d, want at most %d", len(hashes.entries), maxHashes)
+	}
+	if _, ok := hashes.entries[path]; !ok {
+		t.Errorf("hash of %s not memoized", path)
+	}
+}
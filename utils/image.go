@@ -1,15 +1,121 @@
 package utils
 
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
 // ImagePreset defines resize configuration for a named preset.
 type ImagePreset struct {
 	Width      int      // Width in pixels
 	Height     int      // Height in pixels (0 for automatic height based on aspect ratio)
-	Fit        string   // "contain" or "cover"
+	Fit        string   // "contain", "cover", "fill", "inside", "outside", or "pad"
+	Background string   // Background color for "pad": hex color ("fff", "ffffff", "ffffff80") or "transparent"
 	Rotate     int      // Rotation in degrees (0, 90, 180, 270)
 	Flip       string   // "horizontal", "vertical", or "both"
 	Crop       string   // Crop region: "top-left", "top", "top-right", "left", "center", "right", "bottom-left", "bottom", "bottom-right"
+	Enlarge    string   // Upscaling policy: "allow", "never", or "redirect" (empty uses the global policy)
+	Extract    string   // Rectangle to extract before resizing: "x,y,w,h" in pixels or percentages (e.g. "10%,10%,50%,50%")
 	Brightness float64  // Brightness adjustment (-100 to 100)
 	Contrast   float64  // Contrast adjustment (-100 to 100)
 	Gamma      float64  // Gamma adjustment (0.1 to 10.0)
 	Filters    []string // Image filters to apply in order
+
+	CacheControl string `mapstructure:"cache_control"` // Cache-Control header of derivatives (empty uses http_cache.images)
+}
+
+// ExtractArea is a rectangle extracted from the source image before resizing.
+// Each value is either in pixels or, if the matching Percent flag is set, in percent of the source dimension.
+type ExtractArea struct {
+	Values  [4]float64 // Left, top, width, height
+	Percent [4]bool    // Whether the matching value is a percentage
+}
+
+// ParseExtract parses an extract rectangle in the form "x,y,w,h".
+// Values can be given in pixels ("10") or percentages ("10%").
+// Width and height must be greater than 0 and percentages must not exceed 100.
+func ParseExtract(value string) (ExtractArea, error) {
+	var area ExtractArea
+
+	fields := strings.Split(value, ",")
+	if len(fields) != 4 {
+		return area, fmt.Errorf("extract must be in the form x,y,w,h")
+	}
+
+	for i, field := range fields {
+		field = strings.TrimSpace(field)
+		if strings.HasSuffix(field, "%") {
+			area.Percent[i] = true
+			field = strings.TrimSuffix(field, "%")
+		}
+		v, err := strconv.ParseFloat(field, 64)
+		if err != nil || v < 0 {
+			return area, fmt.Errorf("extract value %q must be a non-negative number", fields[i])
+		}
+		if area.Percent[i] && v > 100 {
+			return area, fmt.Errorf("extract value %q must not exceed 100%%", fields[i])
+		}
+		if !area.Percent[i] && v != float64(int(v)) {
+			return area, fmt.Errorf("extract value %q must be a whole number of pixels", fields[i])
+		}
+		area.Values[i] = v
+	}
+
+	if area.Values[2] == 0 || area.Values[3] == 0 {
+		return area, fmt.Errorf("extract width and height must be greater than 0")
+	}
+
+	return area, nil
+}
+
+// Resolve converts the area to pixels against the given source dimensions.
+// Returns left, top, width and height, or an error if the rectangle does not fit inside the source.
+func (area ExtractArea) Resolve(sourceWidth, sourceHeight int) (int, int, int, int, error) {
+	dims := [4]int{sourceWidth, sourceHeight, sourceWidth, sourceHeight}
+
+	var px [4]int
+	for i, v := range area.Values {
+		if area.Percent[i] {
+			px[i] = int(v * float64(dims[i]) / 100)
+		} else {
+			px[i] = int(v)
+		}
+	}
+
+	if px[2] <= 0 || px[3] <= 0 {
+		return 0, 0, 0, 0, fmt.Errorf("extract area is empty for a %dx%d source", sourceWidth, sourceHeight)
+	}
+	if px[0]+px[2] > sourceWidth || px[1]+px[3] > sourceHeight {
+		return 0, 0, 0, 0, fmt.Errorf("extract area %d,%d,%d,%d exceeds source dimensions %dx%d", px[0], px[1], px[2], px[3], sourceWidth, sourceHeight)
+	}
+
+	return px[0], px[1], px[2], px[3], nil
+}
+
+// ParseColor parses a background color given as a hex color with or without a leading "#"
+// ("fff", "ffffff", "ffffff80") or the keyword "transparent".
+// Returns the color normalized to lowercase "rrggbb" or "rrggbbaa" form.
+func ParseColor(value string) (string, error) {
+	value = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(value), "#"))
+	if value == "transparent" {
+		return "00000000", nil
+	}
+
+	if len(value) == 3 || len(value) == 4 {
+		expanded := make([]byte, 0, len(value)*2)
+		for i := 0; i < len(value); i++ {
+			expanded = append(expanded, value[i], value[i])
+		}
+		value = string(expanded)
+	}
+	if len(value) != 6 && len(value) != 8 {
+		return "", fmt.Errorf("color %q must be a 3, 4, 6 or 8 digit hex value or transparent", value)
+	}
+	if _, err := hex.DecodeString(value); err != nil {
+		return "", fmt.Errorf("color %q must be a hex value", value)
+	}
+
+	return value, nil
 }
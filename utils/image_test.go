@@ -0,0 +1,109 @@
+package utils
+
+import "testing"
+
+// TestParseExtract verifies parsing of pixel and percentage extract rectangles.
+func TestParseExtract(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    ExtractArea
+		wantErr bool
+	}{
+		{
+			name:  "pixels",
+			value: "10,20,300,200",
+			want:  ExtractArea{Values: [4]float64{10, 20, 300, 200}},
+		},
+		{
+			name:  "percentages",
+			value: "10%,10%,50%,50%",
+			want:  ExtractArea{Values: [4]float64{10, 10, 50, 50}, Percent: [4]bool{true, true, true, true}},
+		},
+		{
+			name:  "mixed with spaces",
+			value: "0, 5%, 100, 25.5%",
+			want:  ExtractArea{Values: [4]float64{0, 5, 100, 25.5}, Percent: [4]bool{false, true, false, true}},
+		},
+		{name: "too few values", value: "10,20,300", wantErr: true},
+		{name: "non-numeric value", value: "a,20,300,200", wantErr: true},
+		{name: "negative value", value: "-1,20,300,200", wantErr: true},
+		{name: "fractional pixels", value: "1.5,20,300,200", wantErr: true},
+		{name: "percentage over 100", value: "0,0,150%,50%", wantErr: true},
+		{name: "zero width", value: "0,0,0,50", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseExtract(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExtract(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseExtract(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExtractArea_Resolve verifies conversion to pixels and bounds checks against the source.
+func TestExtractArea_Resolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    [4]int
+		wantErr bool
+	}{
+		{name: "pixels inside source", value: "10,20,300,200", want: [4]int{10, 20, 300, 200}},
+		{name: "percentages", value: "10%,10%,50%,50%", want: [4]int{80, 60, 400, 300}},
+		{name: "full source", value: "0,0,100%,100%", want: [4]int{0, 0, 800, 600}},
+		{name: "exceeds width", value: "600,0,300,100", wantErr: true},
+		{name: "exceeds height", value: "0,50%,10,60%", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			area, err := ParseExtract(tt.value)
+			if err != nil {
+				t.Fatalf("ParseExtract(%q) error = %v", tt.value, err)
+			}
+			x, y, w, h, err := area.Resolve(800, 600)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := [4]int{x, y, w, h}; !tt.wantErr && got != tt.want {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseColor verifies hex and keyword background colors are normalized.
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "fff", want: "ffffff"},
+		{value: "#FFF8", want: "ffffff88"},
+		{value: "1a2b3c", want: "1a2b3c"},
+		{value: "#1a2b3c80", want: "1a2b3c80"},
+		{value: "transparent", want: "00000000"},
+		{value: "12345", wantErr: true},
+		{value: "zzzzzz", wantErr: true},
+		{value: "red", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseColor(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColor(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseColor(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
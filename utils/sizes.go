@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// dimensionSpec is a single allowed dimension: either a fixed value or a range with a step.
+type dimensionSpec struct {
+	min  int
+	max  int
+	step int
+}
+
+// SizeSpec is an allowed direct size: a width-only entry ("640", "100-2000:100")
+// or a width and height entry ("640x480", "100-1000:100x100-1000:100").
+type SizeSpec struct {
+	width     dimensionSpec
+	height    dimensionSpec
+	hasHeight bool
+}
+
+// ParseSizeSpec parses an allowed size entry.
+// Each dimension is either a positive number or a range in the form "min-max:step".
+func ParseSizeSpec(value string) (SizeSpec, error) {
+	var spec SizeSpec
+
+	widthPart, heightPart, hasHeight := strings.Cut(strings.TrimSpace(value), "x")
+	width, err := parseDimensionSpec(widthPart)
+	if err != nil {
+		return spec, fmt.Errorf("invalid allowed size %q: %w", value, err)
+	}
+	spec.width = width
+
+	if hasHeight {
+		height, err := parseDimensionSpec(heightPart)
+		if err != nil {
+			return spec, fmt.Errorf("invalid allowed size %q: %w", value, err)
+		}
+		spec.height = height
+		spec.hasHeight = true
+	}
+
+	return spec, nil
+}
+
+// parseDimensionSpec parses a fixed dimension ("640") or a range ("100-2000:100").
+func parseDimensionSpec(value string) (dimensionSpec, error) {
+	bounds, stepPart, hasStep := strings.Cut(value, ":")
+	minPart, maxPart, isRange := strings.Cut(bounds, "-")
+
+	minValue, err := strconv.Atoi(minPart)
+	if err != nil || minValue <= 0 {
+		return dimensionSpec{}, fmt.Errorf("dimension %q must be a positive number", minPart)
+	}
+	if !isRange {
+		if hasStep {
+			return dimensionSpec{}, fmt.Errorf("step is only allowed for ranges")
+		}
+		return dimensionSpec{min: minValue, max: minValue, step: 1}, nil
+	}
+
+	maxValue, err := strconv.Atoi(maxPart)
+	if err != nil || maxValue < minValue {
+		return dimensionSpec{}, fmt.Errorf("range maximum %q must be a number not less than %d", maxPart, minValue)
+	}
+	step := 1
+	if hasStep {
+		if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+			return dimensionSpec{}, fmt.Errorf("range step %q must be a positive number", stepPart)
+		}
+	}
+
+	return dimensionSpec{min: minValue, max: maxValue, step: step}, nil
+}
+
+// nearest returns the allowed value closest to value, preferring the larger one on ties.
+func (d dimensionSpec) nearest(value int) int {
+	if value <= d.min {
+		return d.min
+	}
+	last := d.min + (d.max-d.min)/d.step*d.step
+	if value >= last {
+		return last
+	}
+	lower := d.min + (value-d.min)/d.step*d.step
+	if value-lower < lower+d.step-value {
+		return lower
+	}
+	return lower + d.step
+}
+
+// floor returns the largest allowed value not exceeding value, or false if value is below the minimum.
+func (d dimensionSpec) floor(value int) (int, bool) {
+	if value < d.min {
+		return 0, false
+	}
+	last := d.min + (d.max-d.min)/d.step*d.step
+	if value >= last {
+		return last, true
+	}
+	return d.min + (value-d.min)/d.step*d.step, true
+}
+
+// Nearest returns the size allowed by the spec closest to the requested size.
+// Height must be 0 for width-only requests, which only match width-only specs and vice versa.
+// Returns false if the spec does not apply to the kind of request.
+func (spec SizeSpec) Nearest(width, height int) (int, int, bool) {
+	if spec.hasHeight != (height > 0) {
+		return 0, 0, false
+	}
+	if !spec.hasHeight {
+		return spec.width.nearest(width), 0, true
+	}
+	return spec.width.nearest(width), spec.height.nearest(height), true
+}
+
+// NearestSize returns the allowed size closest to the requested size across all specs,
+// measured as the sum of the absolute differences of both dimensions.
+// Returns false if no spec applies to the kind of request.
+func NearestSize(specs []SizeSpec, width, height int) (int, int, bool) {
+	bestWidth, bestHeight, bestDistance, found := 0, 0, -1, false
+	for _, spec := range specs {
+		w, h, ok := spec.Nearest(width, height)
+		if !ok {
+			continue
+		}
+		distance := abs(w-width) + abs(h-height)
+		if !found || distance < bestDistance || (distance == bestDistance && w > bestWidth) {
+			bestWidth, bestHeight, bestDistance, found = w, h, distance, true
+		}
+	}
+	return bestWidth, bestHeight, found
+}
+
+// LargestSizeWithin returns the largest allowed size across all specs that does not exceed the requested size
+// in either dimension, compared by area. Height must be 0 for width-only requests, as for NearestSize.
+// Returns false if no allowed size fits.
+func LargestSizeWithin(specs []SizeSpec, width, height int) (int, int, bool) {
+	bestWidth, bestHeight, found := 0, 0, false
+	for _, spec := range specs {
+		if spec.hasHeight != (height > 0) {
+			continue
+		}
+		w, ok := spec.width.floor(width)
+		if !ok {
+			continue
+		}
+		h := 0
+		if spec.hasHeight {
+			if h, ok = spec.height.floor(height); !ok {
+				continue
+			}
+		}
+		if !found || w*max(h, 1) > bestWidth*max(bestHeight, 1) || (w*max(h, 1) == bestWidth*max(bestHeight, 1) && w > bestWidth) {
+			bestWidth, bestHeight, found = w, h, true
+		}
+	}
+	return bestWidth, bestHeight, found
+}
+
+// abs returns the absolute value of v.
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,110 @@
+package utils
+
+import "testing"
+
+// TestParseSizeSpec verifies parsing of fixed and ranged allowed size entries.
+func TestParseSizeSpec(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "640"},
+		{value: "640x480"},
+		{value: "100-2000:100"},
+		{value: "100-1000:100x50-500:50"},
+		{value: "100-200"},
+		{value: "0", wantErr: true},
+		{value: "abc", wantErr: true},
+		{value: "640:10", wantErr: true},
+		{value: "200-100:10", wantErr: true},
+		{value: "100-200:0", wantErr: true},
+		{value: "640x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if _, err := ParseSizeSpec(tt.value); (err != nil) != tt.wantErr {
+				t.Errorf("ParseSizeSpec(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestNearestSize verifies snapping requested sizes to the closest allowed size.
+func TestNearestSize(t *testing.T) {
+	var specs []SizeSpec
+	for _, value := range []string{"320", "640", "1000-2000:250", "800x600"} {
+		spec, err := ParseSizeSpec(value)
+		if err != nil {
+			t.Fatalf("ParseSizeSpec(%q) error = %v", value, err)
+		}
+		specs = append(specs, spec)
+	}
+
+	tests := []struct {
+		name       string
+		width      int
+		height     int
+		wantWidth  int
+		wantHeight int
+		wantFound  bool
+	}{
+		{name: "exact width", width: 640, wantWidth: 640, wantFound: true},
+		{name: "nearest fixed width", width: 641, wantWidth: 640, wantFound: true},
+		{name: "tie prefers larger", width: 480, wantWidth: 640, wantFound: true},
+		{name: "range step", width: 1130, wantWidth: 1250, wantFound: true},
+		{name: "above range", width: 5000, wantWidth: 2000, wantFound: true},
+		{name: "width and height", width: 801, height: 601, wantWidth: 800, wantHeight: 600, wantFound: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, found := NearestSize(specs, tt.width, tt.height)
+			if found != tt.wantFound || width != tt.wantWidth || height != tt.wantHeight {
+				t.Errorf("NearestSize(%d, %d) = %d, %d, %v, want %d, %d, %v", tt.width, tt.height, width, height, found, tt.wantWidth, tt.wantHeight, tt.wantFound)
+			}
+		})
+	}
+
+	if _, _, found := NearestSize(specs[:3], 640, 480); found {
+		t.Errorf("NearestSize() found a size for a width and height request without such specs")
+	}
+}
+
+// TestLargestSizeWithin verifies the largest allowed size not exceeding the requested size is found.
+func TestLargestSizeWithin(t *testing.T) {
+	var specs []SizeSpec
+	for _, value := range []string{"320", "640", "1000-2000:250", "400x300", "800x600"} {
+		spec, err := ParseSizeSpec(value)
+		if err != nil {
+			t.Fatalf("ParseSizeSpec(%q) error = %v", value, err)
+		}
+		specs = append(specs, spec)
+	}
+
+	tests := []struct {
+		name       string
+		width      int
+		height     int
+		wantWidth  int
+		wantHeight int
+		wantFound  bool
+	}{
+		{name: "exact width", width: 640, wantWidth: 640, wantFound: true},
+		{name: "fixed width below", width: 999, wantWidth: 640, wantFound: true},
+		{name: "range step below", width: 1400, wantWidth: 1250, wantFound: true},
+		{name: "above range", width: 5000, wantWidth: 2000, wantFound: true},
+		{name: "below all widths", width: 200, wantFound: false},
+		{name: "width and height", width: 799, height: 700, wantWidth: 400, wantHeight: 300, wantFound: true},
+		{name: "height too small", width: 900, height: 200, wantFound: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			width, height, found := LargestSizeWithin(specs, tt.width, tt.height)
+			if found != tt.wantFound || width != tt.wantWidth || height != tt.wantHeight {
+				t.Errorf("LargestSizeWithin(%d, %d) = %d, %d, %v, want %d, %d, %v", tt.width, tt.height, width, height, found, tt.wantWidth, tt.wantHeight, tt.wantFound)
+			}
+		})
+	}
+}
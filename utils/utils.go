@@ -5,6 +5,8 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path"
+	"strings"
 )
 
 // CloseFile safely closes an *os.File and logs any errors that occur.
@@ -20,3 +22,18 @@ func CloseReader(r io.ReadCloser) {
 		slog.Warn("Failed to close reader", "error", err)
 	}
 }
+
+// MatchesGlob reports whether the slash-separated relative path matches any of the glob patterns.
+// Patterns without a slash are matched against the file name only.
+func MatchesGlob(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -38,3 +38,24 @@ func TestCloseReader(t *testing.T) {
 		t.Errorf("Expected error writing to closed file, got nil")
 	}
 }
+
+// TestMatchesGlob verifies path patterns match full relative paths and name patterns match file names.
+func TestMatchesGlob(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		rel      string
+		want     bool
+	}{
+		{patterns: []string{"*.png"}, rel: "photos/cat.png", want: true},
+		{patterns: []string{"photos/*"}, rel: "photos/cat.png", want: true},
+		{patterns: []string{"photos/*"}, rel: "photos/2024/cat.png", want: false},
+		{patterns: []string{"*.jpg", "*.html"}, rel: "index.html", want: true},
+		{patterns: nil, rel: "index.html", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchesGlob(tt.patterns, tt.rel); got != tt.want {
+			t.Errorf("MatchesGlob(%v, %q) = %v, want %v", tt.patterns, tt.rel, got, tt.want)
+		}
+	}
+}
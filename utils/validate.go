@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+)
+
+// validFits lists the supported fit modes.
+var validFits = map[string]bool{
+	"contain": true,
+	"cover":   true,
+	"fill":    true,
+	"inside":  true,
+	"outside": true,
+	"pad":     true,
+}
+
+// validFlips lists the supported flip directions.
+var validFlips = map[string]bool{
+	"horizontal": true,
+	"vertical":   true,
+	"both":       true,
+}
+
+// validCrops lists the supported crop regions.
+var validCrops = map[string]bool{
+	"top-left":     true,
+	"top":          true,
+	"top-right":    true,
+	"left":         true,
+	"center":       true,
+	"right":        true,
+	"bottom-left":  true,
+	"bottom":       true,
+	"bottom-right": true,
+}
+
+// validFilters lists the supported image filters.
+var validFilters = map[string]bool{
+	"grayscale": true,
+	"sepia":     true,
+	"blur":      true,
+	"sharpen":   true,
+	"negate":    true,
+	"invert":    true,
+	"normalize": true,
+	"equalize":  true,
+	"contrast":  true,
+	"edge":      true,
+	"emboss":    true,
+	"charcoal":  true,
+	"solarize":  true,
+	"paint":     true,
+	"oil":       true,
+	"sketch":    true,
+	"vignette":  true,
+}
+
+// ValidateFit checks that fit is a supported fit mode.
+func ValidateFit(fit string) error {
+	if !validFits[fit] {
+		return fmt.Errorf("must be contain, cover, fill, inside, outside, or pad")
+	}
+	return nil
+}
+
+// ValidateRotate checks that rotate is a supported rotation in degrees.
+func ValidateRotate(rotate int) error {
+	if rotate != 0 && rotate != 90 && rotate != 180 && rotate != 270 {
+		return fmt.Errorf("must be 0, 90, 180, or 270")
+	}
+	return nil
+}
+
+// ValidateFlip checks that flip is empty or a supported flip direction.
+func ValidateFlip(flip string) error {
+	if flip != "" && !validFlips[flip] {
+		return fmt.Errorf("must be horizontal, vertical, or both")
+	}
+	return nil
+}
+
+// ValidateCrop checks that crop is empty or a supported crop region.
+func ValidateCrop(crop string) error {
+	if crop != "" && !validCrops[crop] {
+		return fmt.Errorf("must be top-left, top, top-right, left, center, right, bottom-left, bottom, or bottom-right")
+	}
+	return nil
+}
+
+// ValidateBrightness checks that brightness is between -100 and 100.
+func ValidateBrightness(brightness float64) error {
+	return validateRange(brightness, -100, 100)
+}
+
+// ValidateContrast checks that contrast is between -100 and 100.
+func ValidateContrast(contrast float64) error {
+	return validateRange(contrast, -100, 100)
+}
+
+// ValidateGamma checks that gamma is between 0.1 and 10.0.
+func ValidateGamma(gamma float64) error {
+	return validateRange(gamma, 0.1, 10.0)
+}
+
+// ValidateFilter checks that filter is a supported image filter.
+func ValidateFilter(filter string) error {
+	if !validFilters[filter] {
+		return fmt.Errorf("unknown filter %q", filter)
+	}
+	return nil
+}
+
+// validateRange checks that value is a finite number between minValue and maxValue.
+func validateRange(value, minValue, maxValue float64) error {
+	if math.IsNaN(value) || value < minValue || value > maxValue {
+		return fmt.Errorf("must be between %g and %g", minValue, maxValue)
+	}
+	return nil
+}
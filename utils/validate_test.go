@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"math"
+	"testing"
+)
+
+// TestValidators verifies the shared transform validation rules.
+func TestValidators(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "valid fit", err: ValidateFit("pad")},
+		{name: "invalid fit", err: ValidateFit("stretch"), wantErr: true},
+		{name: "valid rotate", err: ValidateRotate(270)},
+		{name: "invalid rotate", err: ValidateRotate(45), wantErr: true},
+		{name: "empty flip", err: ValidateFlip("")},
+		{name: "valid flip", err: ValidateFlip("both")},
+		{name: "invalid flip", err: ValidateFlip("diagonal"), wantErr: true},
+		{name: "empty crop", err: ValidateCrop("")},
+		{name: "valid crop", err: ValidateCrop("bottom-right")},
+		{name: "invalid crop", err: ValidateCrop("middle"), wantErr: true},
+		{name: "valid brightness", err: ValidateBrightness(-100)},
+		{name: "invalid brightness", err: ValidateBrightness(101), wantErr: true},
+		{name: "valid contrast", err: ValidateContrast(100)},
+		{name: "invalid contrast", err: ValidateContrast(-101), wantErr: true},
+		{name: "valid gamma", err: ValidateGamma(2.2)},
+		{name: "gamma too small", err: ValidateGamma(0), wantErr: true},
+		{name: "gamma not a number", err: ValidateGamma(math.NaN()), wantErr: true},
+		{name: "valid filter", err: ValidateFilter("invert")},
+		{name: "invalid filter", err: ValidateFilter("blurr"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", tt.err, tt.wantErr)
+			}
+		})
+	}
+}